@@ -1,8 +1,15 @@
 package tomgjson
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
 	"time"
 )
 
@@ -50,7 +57,7 @@ func ExampleToMgjson() {
 	fmt.Println(string(doc))
 
 	// Output:
-	// {"version":"MGJSON2.0.0","creator":"Juan Irache","dynamicSamplesPresentB":true,"dynamicDataInfo":{"useTimecodeB":false,"utcInfo":{"precisionLength":3,"isGMT":true}},"dataOutline":[{"objectType":"dataDynamic","displayName":"Prime numbers","sampleSetID":"Stream0","dataType":{"type":"numberString","numberStringProperties":{"pattern":{"digitsInteger":1,"digitsDecimal":1,"isSigned":true},"range":{"occuring":{"min":2,"max":7},"legal":{"min":2,"max":7}}},"paddedStringProperties":{"maxLen":0,"maxDigitsInStrLength":0,"eventMarkerB":false}},"interpolation":"linear","hasExpectedFrequecyB":false,"sampleCount":4,"matchName":"Stream0"},{"objectType":"dataDynamic","displayName":"Non primes","sampleSetID":"Stream1","dataType":{"type":"numberString","numberStringProperties":{"pattern":{"digitsInteger":1,"digitsDecimal":1,"isSigned":true},"range":{"occuring":{"min":4,"max":9},"legal":{"min":4,"max":9}}},"paddedStringProperties":{"maxLen":0,"maxDigitsInStrLength":0,"eventMarkerB":false}},"interpolation":"linear","hasExpectedFrequecyB":false,"sampleCount":4,"matchName":"Stream1"},{"objectType":"dataDynamic","displayName":"Colors","sampleSetID":"Stream2","dataType":{"type":"paddedString","numberStringProperties":{"pattern":{"digitsInteger":0,"digitsDecimal":0,"isSigned":false},"range":{"occuring":{"min":0,"max":0},"legal":{"min":0,"max":0}}},"paddedStringProperties":{"maxLen":6,"maxDigitsInStrLength":1,"eventMarkerB":false}},"interpolation":"hold","hasExpectedFrequecyB":false,"sampleCount":4,"matchName":"Stream2"}],"dataDynamicSamples":[{"sampleSetID":"Stream0","samples":[{"time":"1970-01-01T00:00:00.000Z","value":"+2.0"},{"time":"1970-01-01T00:00:10.000Z","value":"+3.0"},{"time":"1970-01-01T00:00:20.000Z","value":"+5.0"},{"time":"1970-01-01T00:00:30.000Z","value":"+7.0"}]},{"sampleSetID":"Stream1","samples":[{"time":"1970-01-01T00:00:00.000Z","value":"+4.0"},{"time":"1970-01-01T00:00:10.000Z","value":"+6.0"},{"time":"1970-01-01T00:00:20.000Z","value":"+8.0"},{"time":"1970-01-01T00:00:30.000Z","value":"+9.0"}]},{"sampleSetID":"Stream2","samples":[{"time":"1970-01-01T00:00:00.000Z","value":{"length":"5","str":"Green "}},{"time":"1970-01-01T00:00:10.000Z","value":{"length":"6","str":"Yellow"}},{"time":"1970-01-01T00:00:20.000Z","value":{"length":"3","str":"Red   "}},{"time":"1970-01-01T00:00:30.000Z","value":{"length":"4","str":"Blue  "}}]}]}
+	// {"version":"MGJSON2.0.0","creator":"Juan Irache","dynamicSamplesPresentB":true,"dynamicDataInfo":{"useTimecodeB":false,"utcInfo":{"precisionLength":3,"isGMT":true}},"dataOutline":[{"objectType":"dataDynamic","displayName":"Prime numbers","sampleSetID":"Prime_numbers","dataType":{"type":"numberString","numberStringProperties":{"pattern":{"digitsInteger":1,"digitsDecimal":1,"isSigned":true},"range":{"occuring":{"min":2,"max":7},"legal":{"min":2,"max":7}}},"paddedStringProperties":{"maxLen":0,"maxDigitsInStrLength":0,"eventMarkerB":false}},"interpolation":"linear","hasExpectedFrequecyB":false,"sampleCount":4,"matchName":"Prime_numbers"},{"objectType":"dataDynamic","displayName":"Non primes","sampleSetID":"Non_primes","dataType":{"type":"numberString","numberStringProperties":{"pattern":{"digitsInteger":1,"digitsDecimal":1,"isSigned":true},"range":{"occuring":{"min":4,"max":9},"legal":{"min":4,"max":9}}},"paddedStringProperties":{"maxLen":0,"maxDigitsInStrLength":0,"eventMarkerB":false}},"interpolation":"linear","hasExpectedFrequecyB":false,"sampleCount":4,"matchName":"Non_primes"},{"objectType":"dataDynamic","displayName":"Colors","sampleSetID":"Colors","dataType":{"type":"paddedString","numberStringProperties":{"pattern":{"digitsInteger":0,"digitsDecimal":0,"isSigned":false},"range":{"occuring":{"min":0,"max":0},"legal":{"min":0,"max":0}}},"paddedStringProperties":{"maxLen":6,"maxDigitsInStrLength":1,"eventMarkerB":false}},"interpolation":"hold","hasExpectedFrequecyB":false,"sampleCount":4,"matchName":"Colors"}],"dataDynamicSamples":[{"sampleSetID":"Prime_numbers","samples":[{"time":"1970-01-01T00:00:00.000Z","value":"+2.0"},{"time":"1970-01-01T00:00:10.000Z","value":"+3.0"},{"time":"1970-01-01T00:00:20.000Z","value":"+5.0"},{"time":"1970-01-01T00:00:30.000Z","value":"+7.0"}]},{"sampleSetID":"Non_primes","samples":[{"time":"1970-01-01T00:00:00.000Z","value":"+4.0"},{"time":"1970-01-01T00:00:10.000Z","value":"+6.0"},{"time":"1970-01-01T00:00:20.000Z","value":"+8.0"},{"time":"1970-01-01T00:00:30.000Z","value":"+9.0"}]},{"sampleSetID":"Colors","samples":[{"time":"1970-01-01T00:00:00.000Z","value":{"length":"5","str":"Green "}},{"time":"1970-01-01T00:00:10.000Z","value":{"length":"6","str":"Yellow"}},{"time":"1970-01-01T00:00:20.000Z","value":{"length":"3","str":"Red   "}},{"time":"1970-01-01T00:00:30.000Z","value":{"length":"4","str":"Blue  "}}]}]}
 }
 
 func ExampleFromCSV() {
@@ -85,3 +92,936 @@ func ExampleFromGPX() {
 	//Output:
 	//At 11:45:55 the position was lat (°): 41.389212, lon (°): 2.147359 and the speed2d (m/s) was 3.057694
 }
+
+func ExampleToMgjson_static() {
+	title := "Morning ride"
+	distance := 42.5
+
+	data := FormattedData{
+		Statics: []Static{
+			{Label: "Title", String: &title},
+			{Label: "Distance (km)", Value: &distance},
+		},
+	}
+
+	doc, _ := ToMgjson(data, "Juan Irache")
+
+	fmt.Println(string(doc))
+
+	// Output:
+	// {"version":"MGJSON2.0.0","creator":"Juan Irache","dynamicSamplesPresentB":false,"dynamicDataInfo":{"useTimecodeB":false,"utcInfo":{"precisionLength":3,"isGMT":true}},"dataOutline":[{"objectType":"dataStatic","displayName":"Title","dataType":{"type":"paddedString","numberStringProperties":{"pattern":{"digitsInteger":0,"digitsDecimal":0,"isSigned":false},"range":{"occuring":{"min":0,"max":0},"legal":{"min":0,"max":0}}},"paddedStringProperties":{"maxLen":12,"maxDigitsInStrLength":2,"eventMarkerB":false}},"matchName":"Title","value":{"length":"12","str":"Morning ride"}},{"objectType":"dataStatic","displayName":"Distance (km)","dataType":{"type":"numberString","numberStringProperties":{"pattern":{"digitsInteger":2,"digitsDecimal":1,"isSigned":true},"range":{"occuring":{"min":42.5,"max":42.5},"legal":{"min":42.5,"max":42.5}}},"paddedStringProperties":{"maxLen":0,"maxDigitsInStrLength":0,"eventMarkerB":false}},"matchName":"Distance_km","value":"+42.5"}],"dataDynamicSamples":[]}
+}
+
+func ExampleFromCSV_array() {
+	src, _ := ioutil.ReadFile("./sample_sources/array-data.csv")
+	converted, _ := FromCSV(src, 0)
+	sample := 2
+	fmt.Printf(
+		`The %q stream has %d dimensions and at %f seconds is %v`,
+		converted.Streams[0].Label,
+		len(converted.Streams[0].Arrays[sample]),
+		converted.Timing[sample].Sub(time.Unix(0, 0)).Seconds(),
+		converted.Streams[0].Arrays[sample],
+	)
+	//Output:
+	//The "acceleration" stream has 3 dimensions and at 0.200000 seconds is [0.41 -9.62 -0.12]
+}
+
+func ExampleToMgjson_groups() {
+	device := "HERO8"
+
+	utc, _ := time.LoadLocation("UTC")
+	now := time.Unix(0, 0).In(utc)
+	plus1, _ := time.ParseDuration("1s")
+
+	data := FormattedData{
+		Timing: []time.Time{now, now.Add(plus1)},
+		Groups: []Group{
+			{
+				Label: "Raw GPS",
+				Streams: []Stream{
+					{Label: "Satellites", Values: []float64{7, 8}},
+				},
+				Groups: []Group{
+					{
+						Label:   "Device",
+						Statics: []Static{{Label: "Camera", String: &device}},
+					},
+				},
+			},
+		},
+	}
+
+	doc, _ := ToMgjson(data, "Juan Irache")
+
+	fmt.Println(string(doc))
+
+	// Output:
+	// {"version":"MGJSON2.0.0","creator":"Juan Irache","dynamicSamplesPresentB":true,"dynamicDataInfo":{"useTimecodeB":false,"utcInfo":{"precisionLength":3,"isGMT":true}},"dataOutline":[{"objectType":"dataGroup","displayName":"Raw GPS","children":[{"objectType":"dataDynamic","displayName":"Satellites","sampleSetID":"Raw_GPS_Satellites","dataType":{"type":"numberString","numberStringProperties":{"pattern":{"digitsInteger":1,"digitsDecimal":1,"isSigned":true},"range":{"occuring":{"min":7,"max":8},"legal":{"min":7,"max":8}}},"paddedStringProperties":{"maxLen":0,"maxDigitsInStrLength":0,"eventMarkerB":false}},"interpolation":"linear","hasExpectedFrequecyB":false,"sampleCount":2,"matchName":"Raw_GPS_Satellites"},{"objectType":"dataGroup","displayName":"Device","children":[{"objectType":"dataStatic","displayName":"Camera","dataType":{"type":"paddedString","numberStringProperties":{"pattern":{"digitsInteger":0,"digitsDecimal":0,"isSigned":false},"range":{"occuring":{"min":0,"max":0},"legal":{"min":0,"max":0}}},"paddedStringProperties":{"maxLen":5,"maxDigitsInStrLength":1,"eventMarkerB":false}},"matchName":"Raw_GPS_Device_Camera","value":{"length":"5","str":"HERO8"}}]}]}],"dataDynamicSamples":[{"sampleSetID":"Raw_GPS_Satellites","samples":[{"time":"1970-01-01T00:00:00.000Z","value":"+7.0"},{"time":"1970-01-01T00:00:01.000Z","value":"+8.0"}]}]}
+}
+
+func ExampleFromGPX_position() {
+	src, _ := ioutil.ReadFile("./sample_sources/gps-path.gpx")
+	converted, _ := FromGPX(src, false)
+	for _, stream := range converted.Streams {
+		if len(stream.Arrays) > 0 {
+			fmt.Println(stream.Label, stream.Arrays[0])
+		}
+	}
+	//Output:
+	//position (°) [41.389262316666674 2.1469447944444444]
+}
+
+func ExampleFromGPX_waypoints() {
+	src, _ := ioutil.ReadFile("./sample_sources/waypoints.gpx")
+	converted, _ := FromGPX(src, false)
+	waypoints := converted.Streams[len(converted.Streams)-1]
+	for i, s := range waypoints.Strings {
+		fmt.Printf("%v marker %q at %v\n", waypoints.EventMarker, s, waypoints.Timing[i].Format("15:04:05.000"))
+	}
+	//Output:
+	//true marker "Start" at 11:45:46.000
+	//true marker "Photo" at 11:45:49.500
+}
+
+func ExampleFromCSV_mixedRate() {
+	src, _ := ioutil.ReadFile("./sample_sources/mixed-rate.csv")
+	converted, _ := FromCSV(src, 0)
+	for _, stream := range converted.Streams {
+		timing := converted.Timing
+		if stream.Timing != nil {
+			timing = stream.Timing
+		}
+		fmt.Printf("%q has %d samples over %v\n", stream.Label, len(stream.Values), timing[len(timing)-1].Sub(timing[0]))
+	}
+	//Output:
+	//"Acceleration (m/s²)" has 11 samples over 1s
+	//"Speed (m/s)" has 3 samples over 1s
+	//"Heart rate (bpm)" has 2 samples over 1s
+}
+
+func ExampleFromGPX_kinds() {
+	src, _ := ioutil.ReadFile("./sample_sources/gps-path.gpx")
+	converted, _ := FromGPX(src, false)
+	for _, stream := range converted.Streams[:5] {
+		fmt.Printf("%q: integer %v\n", stream.Label, stream.Kind == KindInteger)
+	}
+	//Output:
+	//"lat (°)": integer false
+	//"lon (°)": integer false
+	//"ele (m)": integer false
+	//"fix": integer true
+	//"hdop": integer false
+}
+
+func ExampleFromCSV_labelled() {
+	// A header, but no time column, so samples are timed by the frame rate
+	src, _ := ioutil.ReadFile("./sample_sources/labelled-data.csv")
+	converted, _ := FromCSV(src, 25)
+	fmt.Println(converted.Streams[0].Label, len(converted.Streams[0].Values), converted.Timing[1].Sub(converted.Timing[0]))
+	//Output:
+	//Perlin noise 193 40ms
+}
+
+func ExampleFromCSV_kinds() {
+	src, _ := ioutil.ReadFile("./sample_sources/kinds-data.csv")
+	for _, detect := range []bool{false, true} {
+		converted, _ := FromCSVWithOptions(src, CSVOptions{DetectKinds: detect})
+		for _, stream := range converted.Streams {
+			fmt.Printf("%q: integer %v, boolean %v, %v\n", stream.Label, stream.Kind == KindInteger, stream.Kind == KindBoolean, stream.Values)
+		}
+	}
+	//Output:
+	//"Speed (km/h)": integer false, boolean false, [12.4 13.1 12.8 14]
+	//"Lap": integer false, boolean false, [1 1 2 2]
+	//"Recording": integer false, boolean true, [1 1 0 1]
+	//"Speed (km/h)": integer false, boolean false, [12.4 13.1 12.8 14]
+	//"Lap": integer true, boolean false, [1 1 2 2]
+	//"Recording": integer false, boolean true, [1 1 0 1]
+}
+
+func ExampleToMgjson_ids() {
+	utc, _ := time.LoadLocation("UTC")
+	now := time.Unix(0, 0).In(utc)
+	data := FormattedData{
+		Timing: []time.Time{now},
+		Streams: []Stream{
+			{Label: "Speed (km/h)", Unit: UnitKilometerPerHour, Values: []float64{12.4}},
+			{Label: "Speed (mph)", Unit: UnitMilePerHour, Values: []float64{7.7}},
+			{Label: "Speed (km/h)", Values: []float64{12.5}},
+			{ID: "heart", Label: "Heart rate (bpm)", Values: []float64{121}},
+			{Label: "Température", Values: []float64{21.5}},
+			{Label: "心率", Values: []float64{121}},
+		},
+		Groups: []Group{
+			{Label: "Left pedal", Streams: []Stream{{Label: "Power (W)", Values: []float64{210}}}},
+		},
+	}
+	for _, legacy := range []bool{false, true} {
+		doc, _ := ToMgjsonWithOptions(data, Options{LegacyIDs: legacy})
+		converted, _ := FromMgjson(doc)
+		for _, stream := range converted.Streams {
+			fmt.Print(stream.ID, " ")
+		}
+		fmt.Println(converted.Groups[0].Streams[0].ID)
+	}
+	//Output:
+	//Speed_km_h Speed_mph Speed_km_h_2 heart Température 心率 Left_pedal_Power_W
+	//Stream0 Stream1 Stream2 heart Stream4 Stream5 Stream6
+}
+
+func ExampleConvertUnits() {
+	src, _ := ioutil.ReadFile("./sample_sources/gps-path.gpx")
+	converted, _ := FromGPX(src, true)
+	imperial, _ := ConvertUnits(converted, map[Unit]Unit{
+		UnitMeter:          UnitFoot,
+		UnitMeterPerSecond: UnitMilePerHour,
+	})
+	for i, stream := range converted.Streams {
+		if stream.Unit != UnitMeter && stream.Unit != UnitMeterPerSecond {
+			continue
+		}
+		fmt.Printf("%q: %.2f -> %q: %.2f\n", stream.Label, stream.Values[1], imperial.Streams[i].Label, imperial.Streams[i].Values[1])
+	}
+	//Output:
+	//"ele (m)": 50.21 -> "ele (ft)": 164.73
+	//"distance2d (m)": 0.32 -> "distance2d (ft)": 1.05
+	//"distance3d (m)": 0.33 -> "distance3d (ft)": 1.07
+	//"verticalSpeed (m/s)": -0.05 -> "verticalSpeed (mph)": -0.10
+	//"speed2d (m/s)": 0.27 -> "speed2d (mph)": 0.60
+	//"speed3d (m/s)": 0.27 -> "speed3d (mph)": 0.61
+}
+
+func ExampleConvertValue() {
+	pace, _ := ConvertValue(4, UnitMeterPerSecond, UnitMinutePerKilometer)
+	temperature, _ := ConvertValue(21, UnitCelsius, UnitFahrenheit)
+	fmt.Printf("%.2f min/km, %.1f °F\n", pace, temperature)
+	//Output:
+	//4.17 min/km, 69.8 °F
+}
+
+func ExampleFromCSV_multilingual() {
+	src, _ := ioutil.ReadFile("./sample_sources/multilingual-data.csv")
+	converted, _ := FromCSV(src, 0)
+	doc, _ := ToMgjson(converted, "Juan Irache")
+	fmt.Println(len(Validate(doc)), "problems")
+	parsed, _ := FromMgjson(doc)
+	for _, s := range parsed.Streams[0].Strings {
+		fmt.Printf("%+q\n", s)
+	}
+	//Output:
+	//0 problems
+	//"Caf\u00e9"
+	//"Caf\u00e9"
+	//"\u6771\u4eac"
+	//"Z\u00fcrich \U0001f3c1"
+	//"\u0395\u03bb\u03bb\u03ac\u03b4\u03b1"
+}
+
+func ExampleFromCSVWithOptions() {
+	src, _ := ioutil.ReadFile("./sample_sources/european-data.csv")
+	converted, _ := FromCSVWithOptions(src, CSVOptions{
+		DecimalSeparator:   ',',
+		ThousandsSeparator: '.',
+		Comment:            '#',
+	})
+	for _, stream := range converted.Streams {
+		fmt.Printf("%q: %v%q\n", stream.Label, stream.Values, stream.Strings)
+	}
+	//Output:
+	//"Altitude (m)": [1234.5 1236 1240.25][]
+	//"Temperature (°C)": [21.5 21.7 22.1][]
+	//"Note": []["start; warm" "" "end"]
+}
+
+func ExampleCSVOptions_timeColumn() {
+	for _, file := range []string{"timestamp-data.csv", "date-time-data.csv"} {
+		src, _ := ioutil.ReadFile("./sample_sources/" + file)
+		converted, _ := FromCSV(src, 0)
+		fmt.Println(converted.Timing[0].UTC(), len(converted.Streams))
+	}
+	src := []byte("Speed (m/s),seconds since start\n4.1,0\n4.3,0.5\n4.6,1\n")
+	converted, _ := FromCSVWithOptions(src, CSVOptions{TimeIndex: 2, TimeFormat: TimeSeconds})
+	fmt.Println(converted.Timing[2].Sub(converted.Timing[0]), converted.Streams[0].Label)
+	//Output:
+	//2020-05-12 08:00:00 +0000 UTC 2
+	//2020-05-12 23:59:59.5 +0000 UTC 1
+	//1s Speed (m/s)
+}
+
+func ExampleCSVOptions_columns() {
+	src := []byte("milliseconds,spd,Driver,Code,Debug\n0,4.1,Ana,007,x\n100,ERR,Ana,008,y\n200,4.6,Ben,009,z\n")
+	opts := CSVOptions{
+		Columns: map[string]Column{
+			"spd":   {Label: "Speed", Unit: UnitMeterPerSecond},
+			"Code":  {Type: ColumnString},
+			"Debug": {Exclude: true},
+		},
+	}
+	for _, policy := range []CellPolicy{CellError, CellGap, CellSkipRow} {
+		opts.Unparsable = policy
+		converted, err := FromCSVWithOptions(src, opts)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		for _, stream := range converted.Streams {
+			fmt.Printf("%q (%v): %v%q\n", stream.Label, stream.Unit, stream.Values, stream.Strings)
+		}
+	}
+	//Output:
+	//Line 3, column "spd": Seems like strings were found in values column
+	//"Speed" (m/s): [4.1 NaN 4.6][]
+	//"Driver" (): []["Ana" "Ana" "Ben"]
+	//"Code" (): []["007" "008" "009"]
+	//"Speed" (m/s): [4.1 4.6][]
+	//"Driver" (): []["Ana" "Ben"]
+	//"Code" (): []["007" "009"]
+}
+
+func ExampleFromCSVReader() {
+	// Old Mac line endings, one row every 100 milliseconds
+	r := strings.NewReader("milliseconds,Speed (m/s)\r0,4.1\r100,4.3\r200,4.6\r300,4.8\r400,5.0\r")
+	converted, _ := FromCSVReader(r, CSVOptions{From: 100 * time.Millisecond, To: 300 * time.Millisecond})
+	fmt.Println(converted.Timing[0].UTC(), converted.Streams[0].Values)
+	r = strings.NewReader("0.5\n0.6\n0.7\n0.8\n")
+	converted, _ = FromCSVReader(r, CSVOptions{FrameRate: 25, MaxRows: 2})
+	fmt.Println(converted.Timing, converted.Streams[0].Values)
+	//Output:
+	//1970-01-01 00:00:00.1 +0000 UTC [4.3 4.6 4.8]
+	//[1970-01-01 00:00:00 +0000 UTC 1970-01-01 00:00:00.04 +0000 UTC] [0.5 0.6]
+}
+
+func ExampleCSVError() {
+	src := []byte("# Logger export\n\nmilliseconds,Speed (m/s)\n0,4.1\n100,fast\n")
+	_, err := FromCSVWithOptions(src, CSVOptions{Comment: '#'})
+	var csvErr *CSVError
+	if errors.As(err, &csvErr) {
+		fmt.Println(csvErr.Line, csvErr.Column, errors.Is(err, ErrMixedColumn))
+	}
+	fmt.Println(err)
+	//Output:
+	//5 Speed (m/s) true
+	//Line 5, column "Speed (m/s)": Seems like strings were found in values column
+}
+
+func ExampleGPXError() {
+	src := []byte(`<gpx><trk><trkseg>
+	<trkpt lat="41.38" lon="2.17"><time>2020-05-12T10:00:00Z</time><fix></fix></trkpt>
+	<trkpt lat="41.39" lon="2.18"><fix>3d</fix></trkpt>
+	</trkseg></trk></gpx>`)
+	_, err := FromGPX(src, false)
+	fmt.Println(errors.Is(err, ErrMissingTime))
+	fmt.Println(err)
+	//Output:
+	//true
+	//Trkpt 1: Missing timing data in GPX
+}
+
+func ExampleStreamError() {
+	data := FormattedData{
+		Timing:  []time.Time{time.Unix(0, 0)},
+		Streams: []Stream{{Label: "Recording", Values: []float64{2}, Kind: KindBoolean}},
+	}
+	_, err := ToMgjson(data, "Juan Irache")
+	var streamErr *StreamError
+	if errors.As(err, &streamErr) {
+		fmt.Println(streamErr.Label, errors.Is(err, ErrInvalidValue))
+	}
+	fmt.Println(err)
+	//Output:
+	//Recording true
+	//Stream "Recording": Invalid value: booleans must be 0 or 1, found 2
+}
+
+func ExampleToMgjson_display() {
+	decimals := 1
+
+	utc, _ := time.LoadLocation("UTC")
+	now := time.Unix(0, 0).In(utc)
+	plus1, _ := time.ParseDuration("1s")
+
+	data := FormattedData{
+		Timing: []time.Time{now, now.Add(plus1)},
+		Streams: []Stream{
+			{
+				Label:  "Battery (%)",
+				Values: []float64{87.25, 9.04},
+				Display: Display{
+					IntegerDigits: 3,
+					DecimalDigits: &decimals,
+					Unsigned:      true,
+					Legal:         &Range{Min: 0, Max: 100},
+				},
+			},
+		},
+	}
+
+	doc, _ := ToMgjson(data, "Juan Irache")
+
+	fmt.Println(string(doc))
+
+	// Output:
+	// {"version":"MGJSON2.0.0","creator":"Juan Irache","dynamicSamplesPresentB":true,"dynamicDataInfo":{"useTimecodeB":false,"utcInfo":{"precisionLength":3,"isGMT":true}},"dataOutline":[{"objectType":"dataDynamic","displayName":"Battery (%)","sampleSetID":"Battery","dataType":{"type":"numberString","numberStringProperties":{"pattern":{"digitsInteger":3,"digitsDecimal":1,"isSigned":false},"range":{"occuring":{"min":9.04,"max":87.25},"legal":{"min":0,"max":100}}},"paddedStringProperties":{"maxLen":0,"maxDigitsInStrLength":0,"eventMarkerB":false}},"interpolation":"linear","hasExpectedFrequecyB":false,"sampleCount":2,"matchName":"Battery"}],"dataDynamicSamples":[{"sampleSetID":"Battery","samples":[{"time":"1970-01-01T00:00:00.000Z","value":"087.2"},{"time":"1970-01-01T00:00:01.000Z","value":"009.0"}]}]}
+}
+
+func ExampleToMgjsonWithOptions() {
+	utc, _ := time.LoadLocation("UTC")
+
+	data := FormattedData{
+		Timing: []time.Time{time.Unix(0, 1500).In(utc)},
+		Streams: []Stream{
+			{Label: "Data", Values: []float64{1}},
+		},
+	}
+
+	doc, _ := ToMgjsonWithOptions(data, Options{
+		Creator:         "Juan Irache",
+		PrecisionLength: 6,
+		Indent:          "  ",
+	})
+
+	fmt.Println(string(doc))
+
+	// Output:
+	// {
+	//   "version": "MGJSON2.0.0",
+	//   "creator": "Juan Irache",
+	//   "dynamicSamplesPresentB": true,
+	//   "dynamicDataInfo": {
+	//     "useTimecodeB": false,
+	//     "utcInfo": {
+	//       "precisionLength": 6,
+	//       "isGMT": true
+	//     }
+	//   },
+	//   "dataOutline": [
+	//     {
+	//       "objectType": "dataDynamic",
+	//       "displayName": "Data",
+	//       "sampleSetID": "Data",
+	//       "dataType": {
+	//         "type": "numberString",
+	//         "numberStringProperties": {
+	//           "pattern": {
+	//             "digitsInteger": 1,
+	//             "digitsDecimal": 1,
+	//             "isSigned": true
+	//           },
+	//           "range": {
+	//             "occuring": {
+	//               "min": 1,
+	//               "max": 1
+	//             },
+	//             "legal": {
+	//               "min": 1,
+	//               "max": 1
+	//             }
+	//           }
+	//         },
+	//         "paddedStringProperties": {
+	//           "maxLen": 0,
+	//           "maxDigitsInStrLength": 0,
+	//           "eventMarkerB": false
+	//         }
+	//       },
+	//       "interpolation": "linear",
+	//       "hasExpectedFrequecyB": false,
+	//       "sampleCount": 1,
+	//       "matchName": "Data"
+	//     }
+	//   ],
+	//   "dataDynamicSamples": [
+	//     {
+	//       "sampleSetID": "Data",
+	//       "samples": [
+	//         {
+	//           "time": "1970-01-01T00:00:00.000002Z",
+	//           "value": "+1.0"
+	//         }
+	//       ]
+	//     }
+	//   ]
+	// }
+}
+
+func ExampleEncoder() {
+	src, _ := ioutil.ReadFile("./sample_sources/timed-data.csv")
+	converted, _ := FromCSV(src, 0)
+	converted.Timing = converted.Timing[:2]
+	converted.Streams[0].Values = converted.Streams[0].Values[:2]
+
+	NewEncoder(os.Stdout, Options{Creator: "Juan Irache"}).Encode(converted)
+
+	// Output:
+	// {"version":"MGJSON2.0.0","creator":"Juan Irache","dynamicSamplesPresentB":true,"dynamicDataInfo":{"useTimecodeB":false,"utcInfo":{"precisionLength":3,"isGMT":true}},"dataOutline":[{"objectType":"dataDynamic","displayName":"Perlin noise","sampleSetID":"Perlin_noise","dataType":{"type":"numberString","numberStringProperties":{"pattern":{"digitsInteger":1,"digitsDecimal":10,"isSigned":true},"range":{"occuring":{"min":0.5397930392,"max":0.7190434091},"legal":{"min":0.5397930392,"max":0.7190434091}}},"paddedStringProperties":{"maxLen":0,"maxDigitsInStrLength":0,"eventMarkerB":false}},"interpolation":"linear","hasExpectedFrequecyB":false,"sampleCount":2,"matchName":"Perlin_noise"}],"dataDynamicSamples":[{"sampleSetID":"Perlin_noise","samples":[{"time":"1970-01-01T00:00:00.000Z","value":"+0.5397930392"},{"time":"1970-01-01T00:00:00.100Z","value":"+0.7190434091"}]}]}
+}
+
+func ExampleFromMgjson() {
+	src, _ := ioutil.ReadFile("./sample_sources/multiple-data.csv")
+	converted, _ := FromCSV(src, 0)
+	doc, _ := ToMgjson(converted, "Juan Irache")
+
+	parsed, _ := FromMgjson(doc)
+	sample := 5
+	fmt.Printf(
+		"%q is %v at %f seconds\n",
+		parsed.Streams[1].Label,
+		parsed.Streams[1].Values[sample],
+		parsed.Timing[sample].Sub(time.Unix(0, 0)).Seconds(),
+	)
+
+	again, _ := ToMgjson(parsed, "Juan Irache")
+	fmt.Println("Lossless:", string(doc) == string(again))
+
+	//Output:
+	//"Signed 1k Perlin" is 74.1837892462852 at 0.500000 seconds
+	//Lossless: true
+}
+
+func ExampleValidate() {
+	doc := []byte(`{
+		"version": "MGJSON2.0.0",
+		"creator": "Juan Irache",
+		"dynamicSamplesPresentB": true,
+		"dynamicDataInfo": {"useTimecodeB": false, "utcInfo": {"precisionLength": 3, "isGMT": true}},
+		"dataOutline": [{
+			"objectType": "dataDynamic",
+			"displayName": "Speed",
+			"sampleSetID": "Stream0",
+			"dataType": {
+				"type": "numberString",
+				"numberStringProperties": {
+					"pattern": {"digitsInteger": 1, "digitsDecimal": 1, "isSigned": true},
+					"range": {"occuring": {"min": 1, "max": 12}, "legal": {"min": 1, "max": 12}}
+				}
+			},
+			"interpolation": "linear",
+			"sampleCount": 3,
+			"matchName": "Stream0"
+		}],
+		"dataDynamicSamples": [{
+			"sampleSetID": "Stream0",
+			"samples": [
+				{"time": "1970-01-01T00:00:01.000Z", "value": "+1.0"},
+				{"time": "1970-01-01T00:00:00.500Z", "value": "+12.0"}
+			]
+		}]
+	}`)
+
+	for _, problem := range Validate(doc) {
+		fmt.Println(problem)
+	}
+
+	// Output:
+	// $.dataOutline[0].sampleCount: 3, but 2 samples were found
+	// $.dataDynamicSamples[0].samples[1].time: "1970-01-01T00:00:00.500Z" is not after the previous sample
+	// $.dataDynamicSamples[0].samples[1].value: "+12.0" does not match the pattern
+}
+
+func ExampleTimecode() {
+	src, _ := ioutil.ReadFile("./sample_sources/timecode-data.csv")
+	converted, _ := FromCSV(src, 29.97)
+
+	doc, _ := ToMgjsonWithOptions(converted, Options{
+		Creator:  "Juan Irache",
+		Timecode: &Timecode{FrameRate: 29.97, DropFrame: true},
+	})
+
+	fmt.Println(string(doc))
+
+	// Output:
+	// {"version":"MGJSON2.0.0","creator":"Juan Irache","dynamicSamplesPresentB":true,"dynamicDataInfo":{"useTimecodeB":true,"utcInfo":{"precisionLength":3,"isGMT":true},"timecodeInfo":{"frameRate":29.97,"dropFrameB":true}},"dataOutline":[{"objectType":"dataDynamic","displayName":"Heart rate (bpm)","sampleSetID":"Heart_rate_bpm","dataType":{"type":"numberString","numberStringProperties":{"pattern":{"digitsInteger":3,"digitsDecimal":1,"isSigned":true},"range":{"occuring":{"min":121,"max":124},"legal":{"min":121,"max":124}}},"paddedStringProperties":{"maxLen":0,"maxDigitsInStrLength":0,"eventMarkerB":false}},"interpolation":"linear","hasExpectedFrequecyB":false,"sampleCount":4,"matchName":"Heart_rate_bpm"}],"dataDynamicSamples":[{"sampleSetID":"Heart_rate_bpm","samples":[{"time":"00:59:59;28","value":"+121.0"},{"time":"00:59:59;29","value":"+122.0"},{"time":"01:00:00;00","value":"+122.0"},{"time":"01:00:00;01","value":"+124.0"}]}]}
+}
+
+func ExampleFromGPXWithOptions() {
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	src, _ := ioutil.ReadFile("./sample_sources/waypoints.gpx")
+	converted, _ := FromGPXWithOptions(src, GPXOptions{Location: tokyo})
+	timeStream := converted.Streams[len(converted.Streams)-2]
+	fmt.Printf("%q: %v\n", timeStream.Label, timeStream.Strings[0])
+
+	doc, _ := ToMgjsonWithOptions(converted, Options{Location: tokyo})
+	parsed, _ := FromMgjson(doc)
+	fmt.Println("First sample:", parsed.Timing[0])
+
+	//Output:
+	//"time": 2020-02-13T20:45:45.564+09:00
+	//First sample: 2020-02-13 20:45:45.564 +0900 +0900
+}
+
+func ExampleOptions_keepOffset() {
+	// Timestamps written with a +02:00 offset
+	src, _ := ioutil.ReadFile("./sample_sources/timestamp-data.csv")
+	converted, _ := FromCSV(src, 0)
+
+	for _, opts := range []Options{{}, {KeepOffset: true}} {
+		doc, _ := ToMgjsonWithOptions(converted, opts)
+		parsed, _ := FromMgjson(doc)
+		fmt.Println(parsed.Timing[0].Format(time.RFC3339))
+	}
+
+	//Output:
+	//2020-05-12T08:00:00Z
+	//2020-05-12T10:00:00+02:00
+}
+
+func ExampleCollisionPolicy() {
+	utc, _ := time.LoadLocation("UTC")
+	start := time.Unix(0, 0).In(utc)
+
+	data := FormattedData{
+		Timing: []time.Time{start, start.Add(200 * time.Microsecond), start.Add(time.Millisecond)},
+		Streams: []Stream{
+			{Label: "Gyro", Values: []float64{1, 2, 3}},
+		},
+	}
+
+	_, err := ToMgjsonWithOptions(data, Options{Collisions: CollisionError})
+	fmt.Println(err)
+
+	for _, opts := range []Options{
+		{PrecisionLength: 6},
+		{Collisions: CollisionKeepFirst},
+		{Collisions: CollisionKeepLast},
+	} {
+		doc, _ := ToMgjsonWithOptions(data, opts)
+		parsed, _ := FromMgjson(doc)
+		fmt.Println(parsed.Streams[0].Values)
+	}
+
+	// Output:
+	// Stream "Gyro": Samples have the same time once formatted: samples 0 and 1 at 1970-01-01T00:00:00.000Z
+	// [1 2 3]
+	// [1 3]
+	// [2 3]
+}
+
+func ExampleGapPolicy() {
+	utc, _ := time.LoadLocation("UTC")
+	start := time.Unix(0, 0).In(utc)
+
+	data := FormattedData{
+		Timing: []time.Time{start, start.Add(time.Second), start.Add(3 * time.Second), start.Add(4 * time.Second)},
+		Streams: []Stream{
+			{Label: "Elevation", Values: []float64{100, math.NaN(), math.NaN(), 140}},
+		},
+	}
+
+	for _, gaps := range []GapPolicy{GapZero, GapOmit, GapHold, GapInterpolate} {
+		doc, _ := ToMgjsonWithOptions(data, Options{Gaps: gaps})
+		parsed, _ := FromMgjson(doc)
+		fmt.Println(parsed.Streams[0].Values)
+	}
+
+	// Output:
+	// [100 0 0 140]
+	// [100 140]
+	// [100 100 100 140]
+	// [100 110 130 140]
+}
+
+// Converters keep no shared state, so that a server can convert many files at once. Run with -race
+func TestConcurrentConversions(t *testing.T) {
+	files, err := filepath.Glob("./sample_sources/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sample files that need their own options
+	options := map[string]CSVOptions{
+		"european-data.csv": {DecimalSeparator: ',', ThousandsSeparator: '.', Comment: '#'},
+		"timecode-data.csv": {FrameRate: 29.97},
+	}
+
+	convert := func(file string) (string, error) {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		var data FormattedData
+		if filepath.Ext(file) == ".gpx" {
+			data, err = FromGPX(src, true)
+		} else {
+			opts, ok := options[filepath.Base(file)]
+			if !ok {
+				opts = CSVOptions{FrameRate: 25}
+			}
+			data, err = FromCSVWithOptions(src, opts)
+		}
+		if err != nil {
+			return "", err
+		}
+		doc, err := ToMgjson(data, "Juan Irache")
+		if err != nil {
+			return "", err
+		}
+		// And back again, to read mgJSON too
+		data, err = FromMgjson(doc)
+		if err != nil {
+			return "", err
+		}
+		doc, err = ToMgjson(data, "Juan Irache")
+		return string(doc), err
+	}
+
+	expected := map[string]string{}
+	for _, file := range files {
+		doc, err := convert(file)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		expected[file] = doc
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		for _, file := range files {
+			wg.Add(1)
+			go func(file string) {
+				defer wg.Done()
+				doc, err := convert(file)
+				if err != nil {
+					t.Errorf("%s: %v", file, err)
+				} else if doc != expected[file] {
+					t.Errorf("%s converted differently in parallel", file)
+				}
+			}(file)
+		}
+	}
+	wg.Wait()
+}
+
+// Digit counts far beyond mgJSON's limits are reported, rather than crashing Validate
+func TestValidateLargePattern(t *testing.T) {
+	data := FormattedData{
+		Timing:  []time.Time{time.Unix(0, 0), time.Unix(1, 0)},
+		Streams: []Stream{{Label: "Speed", Values: []float64{1, 2}}},
+	}
+	_, err := ToMgjson(FormattedData{Timing: data.Timing, Streams: []Stream{{Label: "Speed", Values: []float64{1, 2}, Display: Display{IntegerDigits: 2000}}}}, "")
+	if !errors.Is(err, ErrInvalidDisplay) {
+		t.Errorf("IntegerDigits 2000: got %v, want ErrInvalidDisplay", err)
+	}
+
+	doc, err := ToMgjson(data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = []byte(strings.Replace(string(doc), `"digitsInteger":1`, `"digitsInteger":2000`, 1))
+	if problems := Validate(doc); len(problems) != 2 {
+		t.Errorf("got %v, want 2 problems", problems)
+	}
+}
+
+// Array samples that don't match arraySize make FromMgjson fail, rather than crash
+func TestFromMgjsonArraySize(t *testing.T) {
+	data := FormattedData{
+		Timing:  []time.Time{time.Unix(0, 0), time.Unix(1, 0)},
+		Streams: []Stream{{Label: "Position", Arrays: [][]float64{{41.1, 2.1}, {41.2, 2.2}}}},
+	}
+	doc, err := ToMgjson(data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = []byte(strings.Replace(string(doc), `["+41.2","+02.2"]`, `["+41.2"]`, 1))
+	_, err = FromMgjson(doc)
+	if !errors.Is(err, ErrMalformed) {
+		t.Errorf("got %v, want ErrMalformed", err)
+	}
+}
+
+// Streams with more than one kind of samples make ToMgjson fail, rather than crash
+func TestToMgjsonMixedSlices(t *testing.T) {
+	data := FormattedData{
+		Timing:  []time.Time{time.Unix(0, 0), time.Unix(1, 0), time.Unix(2, 0)},
+		Streams: []Stream{{Label: "Mixed", Values: []float64{1, 2}, Strings: []string{"a", "b", "c"}}},
+	}
+	_, err := ToMgjson(data, "")
+	if !errors.Is(err, ErrInvalidStream) {
+		t.Errorf("got %v, want ErrInvalidStream", err)
+	}
+}
+
+// Frame rates that round to 0 fps are rejected, rather than dividing by zero
+func TestToMgjsonLowTimecodeRate(t *testing.T) {
+	data := FormattedData{
+		Timing:  []time.Time{time.Unix(0, 0), time.Unix(1, 0)},
+		Streams: []Stream{{Label: "Slow", Values: []float64{1, 2}}},
+	}
+	_, err := ToMgjsonWithOptions(data, Options{Timecode: &Timecode{FrameRate: 0.4}})
+	if !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("got %v, want ErrInvalidOption", err)
+	}
+}
+
+// Timecodes wrap at midnight, which would write samples out of order
+func TestTimecodePastMidnight(t *testing.T) {
+	src, _ := ioutil.ReadFile("./sample_sources/date-time-data.csv")
+	converted, err := FromCSV(src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ToMgjsonWithOptions(converted, Options{Timecode: &Timecode{FrameRate: 25}})
+	if !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("got %v, want ErrInvalidOption", err)
+	}
+}
+
+// Omitting every sample of a stream is an error, rather than an entry without a data type
+func TestGapOmitAllGaps(t *testing.T) {
+	data := FormattedData{
+		Timing:  []time.Time{time.Unix(0, 0), time.Unix(1, 0)},
+		Streams: []Stream{{Label: "Empty", Values: []float64{math.NaN(), math.NaN()}}},
+	}
+	_, err := ToMgjsonWithOptions(data, Options{Gaps: GapOmit})
+	var streamErr *StreamError
+	if !errors.Is(err, ErrNoData) || !errors.As(err, &streamErr) {
+		t.Errorf("got %v, want ErrNoData in a StreamError", err)
+	}
+}
+
+// Decimal commas are never taken for the delimiter, even in files without headers
+func TestSniffDelimiterDecimalComma(t *testing.T) {
+	src := []byte("12,5;3,1\n12,6;3,2\n")
+	converted, err := FromCSVWithOptions(src, CSVOptions{FrameRate: 25, DecimalSeparator: ','})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(converted.Streams[0].Values, converted.Streams[1].Values)
+	if want := "[12.5 12.6] [3.1 3.2]"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// Thousands separators are never taken for the delimiter either
+func TestSniffDelimiterThousandsComma(t *testing.T) {
+	src := []byte("1,234.5;2,345.6\n1,235.5;2,346.6\n")
+	converted, err := FromCSVWithOptions(src, CSVOptions{FrameRate: 25, ThousandsSeparator: ','})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(converted.Streams[0].Values, converted.Streams[1].Values)
+	if want := "[1234.5 1235.5] [2345.6 2346.6]"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	_, err = FromCSVWithOptions(src, CSVOptions{FrameRate: 25, ThousandsSeparator: '.'})
+	if !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("got %v, want ErrInvalidOption", err)
+	}
+}
+
+// Columns found by their header fall back to frame rate timing if their cells are not clearly times
+func TestCSVTimeColumnFallback(t *testing.T) {
+	for _, c := range []struct {
+		src     string
+		opts    CSVOptions
+		streams int
+		err     error
+	}{
+		{"time,value\nfoo,1\nbar,2\n", CSVOptions{FrameRate: 25}, 2, nil},
+		{"time,value\n0,1\n100,2\n", CSVOptions{FrameRate: 25}, 2, nil},
+		{"time,value\n0,1\n100,2\n", CSVOptions{}, 0, ErrNoTiming},
+		{"time,value\n0,1\n100,2\n", CSVOptions{TimeFormat: TimeMilliseconds}, 1, nil},
+		{"epoch,value\n1589270400,1\n1589270401,2\n", CSVOptions{}, 1, nil},
+		{"day,value\n2020-05-12,1\n2020-05-13,2\n", CSVOptions{FrameRate: 25, DateColumn: "day"}, 0, ErrNoTiming},
+		{"0,1.5\n100,2.5\n", CSVOptions{TimeIndex: 1, TimeFormat: TimeMilliseconds}, 1, nil},
+		{"0,1.5\n100,2.5\n", CSVOptions{FrameRate: 25, TimeColumn: "time"}, 0, ErrNoTiming},
+	} {
+		converted, err := FromCSVWithOptions([]byte(c.src), c.opts)
+		if !errors.Is(err, c.err) || len(converted.Streams) != c.streams {
+			t.Errorf("%q: got %d streams and %v, want %d streams and %v", c.src, len(converted.Streams), err, c.streams, c.err)
+		}
+	}
+}
+
+// A point without elevation doesn't lose the ground it covers from the 3D distance
+func TestGPXDistance3dElevationGap(t *testing.T) {
+	src := []byte(`<gpx><trk><trkseg>
+<trkpt lat="41.00" lon="2.00"><ele>100</ele><time>2020-05-12T10:00:00Z</time></trkpt>
+<trkpt lat="41.01" lon="2.00"><time>2020-05-12T10:01:00Z</time></trkpt>
+<trkpt lat="41.02" lon="2.00"><ele>100</ele><time>2020-05-12T10:02:00Z</time></trkpt>
+</trkseg></trk></gpx>`)
+	converted, err := FromGPX(src, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := func(label string) []float64 {
+		for _, st := range converted.Streams {
+			if st.Label == label {
+				return st.Values
+			}
+		}
+		t.Fatalf("no %v stream", label)
+		return nil
+	}
+	d2, d3 := values("distance2d (m)"), values("distance3d (m)")
+	for i := range d2 {
+		if !(math.Abs(d3[i]-d2[i]) < 1e-6) {
+			t.Errorf("sample %d: distance3d is %v, distance2d is %v", i, d3[i], d2[i])
+		}
+	}
+	if speed := values("speed3d (m/s)"); math.IsNaN(speed[2]) {
+		t.Errorf("speed3d after the gap is NaN")
+	}
+}
+
+// Cells read as gaps with CellGap are written according to Options.Gaps, while empty cells are left out
+func TestCSVCellGapPolicy(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want string
+	}{
+		{"milliseconds,v\n0,1\n100,x\n200,3\n", "[1 2 3]"},
+		{"milliseconds,v\n0,1\n100,\n200,3\n", "[1 3]"},
+	} {
+		converted, err := FromCSVWithOptions([]byte(c.src), CSVOptions{Unparsable: CellGap})
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := ToMgjsonWithOptions(converted, Options{Gaps: GapInterpolate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := FromMgjson(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(back.Streams[0].Values); got != c.want {
+			t.Errorf("%q: got %v, want %v", c.src, got, c.want)
+		}
+	}
+}
+
+// Waypoints with bad times return a GPXError with their name
+func TestGPXWaypointError(t *testing.T) {
+	src := []byte(`<gpx><wpt lat="41.38" lon="2.17"><name>Start</name><time>yesterday</time></wpt><trk><trkseg>
+<trkpt lat="41.38" lon="2.17"><time>2020-05-12T10:00:00Z</time></trkpt>
+<trkpt lat="41.39" lon="2.18"><time>2020-05-12T10:00:01Z</time></trkpt>
+</trkseg></trk></gpx>`)
+	_, err := FromGPX(src, false)
+	var gpxErr *GPXError
+	if !errors.As(err, &gpxErr) || gpxErr.Waypoint != "Start" {
+		t.Errorf("got %v, want a GPXError in waypoint \"Start\"", err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+// Write errors of the output stream are returned by Encode
+func TestEncoderWriteError(t *testing.T) {
+	src, _ := ioutil.ReadFile("./sample_sources/gps-path.gpx")
+	converted, err := FromGPX(src, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewEncoder(failingWriter{}, Options{}).Encode(converted)
+	if err == nil || err.Error() != "disk full" {
+		t.Errorf("got %v, want disk full", err)
+	}
+}
@@ -0,0 +1,272 @@
+package tomgjson
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeFormat is the format of the time column of a CSV file
+// Numbers are relative to the start of the video, or to the Unix epoch for absolute times, unless there is a date column
+type TimeFormat string
+
+// Supported time formats. TimeAuto detects them from the header and the values of the column
+const (
+	TimeAuto         TimeFormat = ""
+	TimeSeconds      TimeFormat = "seconds"
+	TimeMilliseconds TimeFormat = "milliseconds"
+	TimeMicroseconds TimeFormat = "microseconds"
+	// TimeISO8601 timestamps like "2020-05-12T10:00:00.250Z". Without a time zone, they use CSVOptions.Location
+	TimeISO8601 TimeFormat = "iso8601"
+	// TimeClock times like "10:00:00.250", of the day (with a date column) or since the start of the video
+	TimeClock TimeFormat = "clock"
+	// TimeTimecode SMPTE timecodes like "10:00:00:06", which need CSVOptions.FrameRate
+	TimeTimecode TimeFormat = "timecode"
+	// TimeFrames frame numbers, which need CSVOptions.FrameRate
+	TimeFrames TimeFormat = "frames"
+)
+
+// Headers of a left-aligned column that is read as the time column when none is set
+var timeHeaders = map[string]TimeFormat{
+	"milliseconds": TimeMilliseconds,
+	"ms":           TimeMilliseconds,
+	"microseconds": TimeMicroseconds,
+	"seconds":      TimeSeconds,
+	"timecode":     TimeTimecode,
+	"frame":        TimeFrames,
+	"frames":       TimeFrames,
+	"time":         TimeAuto,
+	"timestamp":    TimeAuto,
+	"datetime":     TimeAuto,
+	"epoch":        TimeAuto,
+}
+
+// Timestamps without a custom layout are tried with these, in order. Fractions of a second are always accepted
+var isoLayouts = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+}
+
+var clockFormat = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2}(?:\.\d+)?)$`)
+
+// Returns the index of the time column and of the date column (or -1), according to the options
+// or to the headers of the first columns. ok is false if the file has no time column
+func timeColumns(headers []string, opts CSVOptions) (int, int, bool, error) {
+	date := -1
+
+	if opts.DateColumn != "" {
+		date = headerIndex(headers, opts.DateColumn)
+		if date < 0 {
+			return 0, 0, false, fmt.Errorf("%w: no date column %q", ErrNoTiming, opts.DateColumn)
+		}
+	}
+
+	if opts.TimeIndex > 0 {
+		if opts.TimeIndex > len(headers) {
+			return 0, 0, false, fmt.Errorf("%w: no time column at position %d", ErrNoTiming, opts.TimeIndex)
+		}
+		return opts.TimeIndex - 1, date, true, nil
+	}
+
+	if opts.TimeColumn != "" {
+		column := headerIndex(headers, opts.TimeColumn)
+		if column < 0 {
+			return 0, 0, false, fmt.Errorf("%w: no time column %q", ErrNoTiming, opts.TimeColumn)
+		}
+		return column, date, true, nil
+	}
+
+	// Left-aligned "date" and "time" columns
+	if len(headers) > 1 && strings.EqualFold(headers[0], "date") && strings.EqualFold(headers[1], "time") {
+		return 1, 0, true, nil
+	}
+
+	if _, ok := timeHeaders[strings.ToLower(headers[0])]; ok {
+		return 0, date, true, nil
+	}
+
+	if date >= 0 {
+		return 0, 0, false, fmt.Errorf("%w: date column %q without a time column", ErrNoTiming, opts.DateColumn)
+	}
+
+	return 0, 0, false, nil
+}
+
+func headerIndex(headers []string, name string) int {
+	for i, h := range headers {
+		if h == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Detects the format of a time column from its header, or else from its first cell
+// sure is false for small numbers under a header like "time", which could be seconds or milliseconds since the start
+func detectTimeFormat(header, cell string, hasDate bool, opts CSVOptions) (format TimeFormat, sure bool) {
+	header = strings.ToLower(header)
+	if format, ok := timeHeaders[header]; ok && format != TimeAuto {
+		return format, true
+	}
+
+	v, _, err := parseCell(cell, opts)
+	if err != nil {
+		cell = strings.TrimSpace(cell)
+		if timecodeFormat.MatchString(cell) {
+			return TimeTimecode, true
+		}
+		if clockFormat.MatchString(cell) {
+			return TimeClock, true
+		}
+		return TimeISO8601, true
+	}
+
+	// Absolute times are told apart by their magnitude: seconds since 1973, or milliseconds or microseconds
+	switch {
+	case hasDate:
+		return TimeSeconds, true
+	case math.Abs(v) > 1e14:
+		return TimeMicroseconds, true
+	case math.Abs(v) > 1e11:
+		return TimeMilliseconds, true
+	default:
+		return TimeSeconds, header == "epoch" || math.Abs(v) >= 1e8
+	}
+}
+
+// Converts a number of units to a duration, keeping large absolute times exact
+// The fraction is rounded to the precision of the float, so that 1589270400.123 s is not 1589270400.122999907 s
+func floatDuration(v float64, unit time.Duration) time.Duration {
+	whole := math.Trunc(v)
+	ulp := (math.Nextafter(math.Abs(v), math.Inf(1)) - math.Abs(v)) * float64(unit)
+	step := math.Max(1, math.Pow(10, math.Ceil(math.Log10(ulp))))
+	fraction := math.Round((v-whole)*float64(unit)/step) * step
+	return time.Duration(whole)*unit + time.Duration(fraction)
+}
+
+// Parses a time of the day, or elapsed, like "10:00:00.250"
+func parseClock(s string) (time.Duration, error) {
+	match := clockFormat.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return 0, fmt.Errorf("Badly formatted time: %q", s)
+	}
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+	if minutes > 59 || seconds >= 60 {
+		return 0, fmt.Errorf("Time out of range: %q", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(math.Round(seconds*1e9)), nil
+}
+
+// Parses a timestamp with the custom layout, or any of the ISO 8601 layouts
+func parseTimestamp(s string, opts CSVOptions, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if opts.TimeLayout != "" {
+		return time.ParseInLocation(opts.TimeLayout, s, loc)
+	}
+	var err error
+	for _, layout := range isoLayouts {
+		var t time.Time
+		t, err = time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// Converts the cells of the time column, and of the optional date column, to times
+type timeReader struct {
+	opts    CSVOptions
+	header  string
+	format  TimeFormat
+	hasDate bool
+	loc     *time.Location
+	tc      Timecode
+	// The column was found by its header, so times in an uncertain format are an error
+	auto bool
+}
+
+func newTimeReader(header string, hasDate bool, opts CSVOptions) *timeReader {
+	tr := &timeReader{
+		opts:    opts,
+		header:  header,
+		format:  opts.TimeFormat,
+		hasDate: hasDate,
+		loc:     opts.Location,
+		tc:      Timecode{FrameRate: opts.FrameRate},
+	}
+	if tr.loc == nil {
+		tr.loc = time.UTC
+	}
+	if opts.TimeLayout != "" {
+		tr.format = TimeISO8601
+	}
+	return tr
+}
+
+// Returns the time of a row. The format is detected from the first cell, unless it is set
+func (tr *timeReader) read(cell, date string) (time.Time, error) {
+	if strings.TrimSpace(cell) == "" {
+		return time.Time{}, fmt.Errorf("%w: missing time", ErrNoTiming)
+	}
+	if tr.format == TimeAuto {
+		format, sure := detectTimeFormat(tr.header, cell, tr.hasDate, tr.opts)
+		if !sure && tr.auto {
+			return time.Time{}, fmt.Errorf("%w: %q could be seconds or milliseconds, set the TimeFormat", ErrNoTiming, cell)
+		}
+		tr.format = format
+	}
+	if (tr.format == TimeTimecode || tr.format == TimeFrames) && tr.opts.FrameRate <= 0 {
+		return time.Time{}, fmt.Errorf("%w: %s need a frame rate", ErrInvalidOption, tr.format)
+	}
+
+	if tr.format == TimeISO8601 {
+		return parseTimestamp(cell, tr.opts, tr.loc)
+	}
+
+	// Relative times start at the Unix epoch, or at the midnight of their date
+	base := time.Unix(0, 0).In(tr.loc)
+	if tr.hasDate {
+		layout := tr.opts.DateLayout
+		if layout == "" {
+			layout = "2006-01-02"
+		}
+		var err error
+		base, err = time.ParseInLocation(layout, strings.TrimSpace(date), tr.loc)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	switch tr.format {
+	case TimeClock:
+		d, err := parseClock(cell)
+		return base.Add(d), err
+	case TimeTimecode:
+		d, err := tr.tc.parse(strings.TrimSpace(cell))
+		return base.Add(d), err
+	}
+
+	v, _, err := parseCell(cell, tr.opts)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch tr.format {
+	case TimeSeconds:
+		return base.Add(floatDuration(v, time.Second)), nil
+	case TimeMilliseconds:
+		return base.Add(floatDuration(v, time.Millisecond)), nil
+	case TimeMicroseconds:
+		return base.Add(floatDuration(v, time.Microsecond)), nil
+	case TimeFrames:
+		return base.Add(floatDuration(v/tr.opts.FrameRate, time.Second)), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: unknown time format %q", ErrInvalidOption, tr.format)
+}
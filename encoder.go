@@ -0,0 +1,191 @@
+package tomgjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Encoder writes mgJSON documents to an output stream
+type Encoder struct {
+	w    io.Writer
+	opts Options
+}
+
+// NewEncoder returns an Encoder that writes to w with the document-level settings of opts
+// Indent is ignored, the Encoder always writes compact JSON
+func NewEncoder(w io.Writer, opts Options) *Encoder {
+	return &Encoder{w: w, opts: opts}
+}
+
+// Encode writes the mgJSON document of a formatted source data (FormattedData), or returns an error
+// A first pass computes the outline (patterns, ranges...) of every stream. Then the samples are formatted and written one by one,
+// so the JSON document is never held in memory. Streams with gaps, colliding times or strings are copied while
+// computing their outline, so memory use can still reach the size of the input data, but not of the output
+func (e *Encoder) Encode(sd FormattedData) error {
+	opts := e.opts
+
+	if opts.Version == "" {
+		opts.Version = defaultMgjsonVersion
+	}
+
+	if opts.PrecisionLength == 0 {
+		opts.PrecisionLength = defaultPrecisionLength
+	}
+
+	if opts.PrecisionLength < 1 || opts.PrecisionLength > 9 {
+		return fmt.Errorf("%w: precision length must be between 1 and 9", ErrInvalidOption)
+	}
+
+	// Times are rounded to the precision, as Format would truncate them
+	fraction := "." + strings.Repeat("0", opts.PrecisionLength)
+	step := time.Duration(math.Pow10(9 - opts.PrecisionLength))
+	formatTime := func(t time.Time) string {
+		t = t.Round(step)
+		if opts.Location != nil {
+			return t.In(opts.Location).Format("2006-01-02T15:04:05" + fraction + "-07:00")
+		}
+		if opts.KeepOffset {
+			return t.Format("2006-01-02T15:04:05" + fraction + "-07:00")
+		}
+		return t.UTC().Format("2006-01-02T15:04:05" + fraction + "Z")
+	}
+
+	var tcInfo *timecodeInfo
+	if opts.Timecode != nil {
+		err := opts.Timecode.validate()
+		if err != nil {
+			return err
+		}
+		formatTime = func(t time.Time) string {
+			if opts.Location != nil {
+				t = t.In(opts.Location)
+			}
+			return opts.Timecode.format(t)
+		}
+		tcInfo = &timecodeInfo{
+			FrameRate:  opts.Timecode.FrameRate,
+			DropFrameB: opts.Timecode.DropFrame,
+		}
+	}
+
+	b := outlineBuilder{
+		timing:     sd.Timing,
+		formatTime: formatTime,
+		timecode:   opts.Timecode != nil,
+		gaps:       opts.Gaps,
+		collisions: opts.Collisions,
+		legacyIDs:  opts.LegacyIDs,
+	}
+
+	b.reserve(sd.Streams, sd.Statics, sd.Groups)
+	dataOutline, err := b.outline("", sd.Streams, sd.Statics, sd.Groups)
+	if err != nil {
+		return err
+	}
+
+	if b.streams < 1 && b.statics < 1 {
+		return ErrNoStreams
+	}
+
+	data := mgjson{
+		Version:                opts.Version,
+		Creator:                opts.Creator,
+		DynamicSamplesPresentB: b.streams > 0,
+		DynamicDataInfo: dynamicDataInfo{
+			UseTimecodeB: opts.Timecode != nil,
+			UtcInfo: utcInfo{
+				PrecisionLength: opts.PrecisionLength,
+				IsGMT:           opts.Location == nil && !opts.KeepOffset,
+			},
+			TimecodeInfo: tcInfo,
+		},
+		DataOutline:        dataOutline,
+		DataDynamicSamples: []dataDynamicSample{},
+	}
+
+	header, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	// The samples are written in place of the empty dataDynamicSamples array, before its closing bracket
+	header = bytes.TrimSuffix(header, []byte("]}"))
+
+	bw := bufio.NewWriter(e.w)
+	_, err = bw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for i, set := range b.sets {
+		if i > 0 {
+			err = bw.WriteByte(',')
+			if err != nil {
+				return err
+			}
+		}
+		err = writeSampleSet(bw, set, formatTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = bw.WriteString("]}")
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// Writes the samples of a sample set, formatting them as they go
+func writeSampleSet(bw *bufio.Writer, set sampleSet, formatTime func(time.Time) string) error {
+	id, err := json.Marshal(set.id)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range []string{`{"sampleSetID":`, string(id), `,"samples":[`} {
+		_, err = bw.WriteString(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < streamLength(set.stream); i++ {
+		var value interface{}
+		if len(set.stream.Values) > 0 {
+			value = paddedNumber(set.stream.Values[i], set.pattern)
+		} else if len(set.stream.Strings) > 0 {
+			value = paddedString(set.stream.Strings[i], set.maxLen, set.maxDigitsInStrLength)
+		} else {
+			value = paddedArray(set.stream.Arrays[i], set.pattern)
+		}
+		doc, err := json.Marshal(sample{
+			Time:  formatTime(set.timing[i]),
+			Value: value,
+		})
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			err = bw.WriteByte(',')
+			if err != nil {
+				return err
+			}
+		}
+		_, err = bw.Write(doc)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = bw.WriteString("]}")
+	return err
+}
@@ -0,0 +1,104 @@
+package tomgjson
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the converters, often wrapped with more details or in a CSVError, GPXError or StreamError.
+// Check them with errors.Is
+var (
+	// ErrNoData means that a source has no data that can be converted
+	ErrNoData = errors.New("No valid data found")
+	// ErrNoStreams means that FormattedData has no streams nor static fields
+	ErrNoStreams = errors.New("No streams found")
+	// ErrNoTiming means that a stream has no timing data, or a CSV file has no times nor frame rate
+	ErrNoTiming = errors.New("No timing data")
+	// ErrTimingLength means that the timing of a stream does not match the number of its samples
+	ErrTimingLength = errors.New("Timing data does not match slice length")
+	// ErrTimeCollision means that two samples of a stream have the same time once formatted (see CollisionPolicy)
+	ErrTimeCollision = errors.New("Samples have the same time once formatted")
+	// ErrMixedColumn means that a CSV column has both numbers and strings
+	ErrMixedColumn = errors.New("Seems like strings were found in values column")
+	// ErrMissingTime means that a GPX trkpt has no time
+	ErrMissingTime = errors.New("Missing timing data in GPX")
+	// ErrNotEnoughPoints means that a GPX file has no tracks, no segments or fewer than two trkpt
+	ErrNotEnoughPoints = errors.New("Not enough GPX data")
+	// ErrInvalidStream means that the settings of a stream do not fit its data (interpolation, event markers, dimensions...)
+	ErrInvalidStream = errors.New("Invalid stream")
+	// ErrInvalidStatic means that a static field has both a value and a string, or none
+	ErrInvalidStatic = errors.New("Invalid static field")
+	// ErrInvalidValue means that a value is not allowed by its stream (negative but unsigned, boolean but not 0 or 1...)
+	ErrInvalidValue = errors.New("Invalid value")
+	// ErrInvalidDisplay means that the Display settings of a stream or static field are not valid
+	ErrInvalidDisplay = errors.New("Invalid display settings")
+	// ErrDuplicateID means that an explicit ID is used by more than one stream or static field
+	ErrDuplicateID = errors.New("ID used more than once")
+	// ErrInvalidOption means that an option is out of range (precision length, timecode frame rate...)
+	ErrInvalidOption = errors.New("Invalid option")
+	// ErrInvalidTimecode means that a timecode is badly formatted or out of range
+	ErrInvalidTimecode = errors.New("Invalid timecode")
+	// ErrUnknownUnit means that a unit is not supported, or missing, for a conversion
+	ErrUnknownUnit = errors.New("Unknown unit")
+	// ErrIncompatibleUnits means that two units measure different quantities, or that a stream has no numbers to convert
+	ErrIncompatibleUnits = errors.New("Incompatible units")
+	// ErrUnsupported means that an mgJSON document uses object or data types that are not supported
+	ErrUnsupported = errors.New("Unsupported mgJSON content")
+	// ErrMalformed means that an mgJSON document is missing data that it refers to, or is badly formatted
+	ErrMalformed = errors.New("Malformed mgJSON")
+)
+
+// CSVError is an error found in a CSV record. Line is the line of the file where the record starts, from 1,
+// counting the header, comments and blank lines. Column is the header of the column, if any
+type CSVError struct {
+	Line   int
+	Column string
+	Err    error
+}
+
+func (e *CSVError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("Line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("Line %d, column %q: %v", e.Line, e.Column, e.Err)
+}
+
+// Unwrap returns the underlying error, for errors.Is and errors.As
+func (e *CSVError) Unwrap() error {
+	return e.Err
+}
+
+// GPXError is an error found in a trkpt of a GPX file. Trkpt is its index in the first track, from 0
+// Errors found in a waypoint have its name in Waypoint instead
+type GPXError struct {
+	Trkpt    int
+	Waypoint string
+	Err      error
+}
+
+func (e *GPXError) Error() string {
+	if e.Waypoint != "" {
+		return fmt.Sprintf("Waypoint %q: %v", e.Waypoint, e.Err)
+	}
+	return fmt.Sprintf("Trkpt %d: %v", e.Trkpt, e.Err)
+}
+
+// Unwrap returns the underlying error, for errors.Is and errors.As
+func (e *GPXError) Unwrap() error {
+	return e.Err
+}
+
+// StreamError is an error found in a stream or static field, identified by its label
+type StreamError struct {
+	Label string
+	Err   error
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("Stream %q: %v", e.Label, e.Err)
+}
+
+// Unwrap returns the underlying error, for errors.Is and errors.As
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
@@ -1,115 +1,681 @@
 package tomgjson
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"math"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
-	"bytes"
 )
 
-// Returns valid streams with values or strings
-func structureData(headers []string, table [][]string) ([]Stream, error) {
+// Builds valid streams with values or strings from the rows of a CSV file
+// Headers ending with a supported unit, like "speed (m/s)", set the unit of their stream
+// Columns of true and false are booleans. With DetectKinds, columns of numbers without decimals are integers,
+// or booleans if they only contain 0 and 1
+// Empty cells in values columns are kept as NaN, so that they can be removed once the timing is known
+// Cells read as gaps with CellGap are NaN too, but they stay in the stream as missing values
+type columnBuilder struct {
+	headers []string
+	opts    CSVOptions
+	streams []Stream
+	// Types forced by the options
+	types []ColumnType
+	// Empty cells found before knowing the type of their column
+	blanks []int
+	// Whether numbers with decimals, or true and false, were found in each column
+	decimals []bool
+	words    []bool
+	// Indexes of the values read as gaps in each column
+	gaps []map[int]bool
+}
 
-	streams := []Stream{}
+func newColumnBuilder(headers []string, opts CSVOptions) *columnBuilder {
+	cb := &columnBuilder{
+		headers:  headers,
+		opts:     opts,
+		streams:  make([]Stream, len(headers)),
+		types:    make([]ColumnType, len(headers)),
+		blanks:   make([]int, len(headers)),
+		decimals: make([]bool, len(headers)),
+		words:    make([]bool, len(headers)),
+		gaps:     make([]map[int]bool, len(headers)),
+	}
+	for i, h := range headers {
+		cb.streams[i] = Stream{
+			Label: h,
+			Unit:  labelUnit(h),
+		}
+		column, ok := opts.Columns[h]
+		cb.types[i] = column.Type
+		if column.Exclude || (!ok && opts.ExcludeOthers) {
+			cb.types[i] = columnSkip
+		}
+	}
+	return cb
+}
+
+// Returns the type forced on a column by the options, if any
+func (cb *columnBuilder) columnType(i int) ColumnType {
+	return cb.types[i]
+}
+
+// Whether a column is read as numbers, once forced or after finding its first number
+func (cb *columnBuilder) numeric(i int) bool {
+	t := cb.columnType(i)
+	return t == ColumnNumber || t == ColumnInteger || t == ColumnBoolean || (t == ColumnAuto && len(cb.streams[i].Values) > 0)
+}
 
-	for _, xs := range table {
-		for i, s := range xs {
-			if len(streams) < i+1 {
-				streams = append(streams, Stream{
-					Label: headers[i],
-				})
+// Adds a row of cells to the columns, unless it is skipped. line is its line in the file, to locate errors
+// Cells that can't be read as numbers in values columns are handled according to the Unparsable policy
+func (cb *columnBuilder) add(row []string, line int) (bool, error) {
+	values := make([]float64, len(row))
+	parsed := make([]bool, len(row))
+	decimals := make([]bool, len(row))
+	gaps := make([]bool, len(row))
+
+	for i, s := range row {
+		if len(s) < 1 || cb.columnType(i) == ColumnString || cb.columnType(i) == columnSkip {
+			continue
+		}
+		var err error
+		values[i], decimals[i], err = parseCell(s, cb.opts)
+		parsed[i] = err == nil
+		if !parsed[i] && cb.numeric(i) {
+			switch cb.opts.Unparsable {
+			case CellSkipRow:
+				return false, nil
+			case CellGap:
+				gaps[i] = true
+			default:
+				return false, &CSVError{Line: line, Column: cb.headers[i], Err: ErrMixedColumn}
 			}
-			val, err := strconv.ParseFloat(s, 64)
-			if err == nil {
-				streams[i].Values = append(streams[i].Values, val)
-			} else {
-				if len(streams[i].Values) > 0 {
-					return streams, fmt.Errorf("Seems like strings were found in values column")
-				}
-				streams[i].Strings = append(streams[i].Strings, s)
+		}
+	}
+
+	for i, s := range row {
+		st := &cb.streams[i]
+		if cb.columnType(i) == columnSkip {
+			continue
+		}
+		if gaps[i] {
+			if cb.gaps[i] == nil {
+				cb.gaps[i] = map[int]bool{}
+			}
+			cb.gaps[i][len(st.Values)] = true
+		}
+		if len(s) < 1 || gaps[i] {
+			switch {
+			case cb.columnType(i) != ColumnAuto || len(st.Values) > 0:
+				cb.blank(i)
+			case len(st.Strings) > 0:
+				st.Strings = append(st.Strings, "")
+			default:
+				cb.blanks[i]++
+			}
+			continue
+		}
+		if parsed[i] && len(st.Strings) < 1 {
+			if decimals[i] {
+				cb.decimals[i] = true
+			}
+			if booleanWord(s) {
+				cb.words[i] = true
+			}
+			for ; cb.blanks[i] > 0; cb.blanks[i]-- {
+				st.Values = append(st.Values, math.NaN())
+			}
+			st.Values = append(st.Values, values[i])
+		} else {
+			for ; cb.blanks[i] > 0; cb.blanks[i]-- {
+				st.Strings = append(st.Strings, "")
+			}
+			st.Strings = append(st.Strings, s)
+		}
+	}
+
+	return true, nil
+}
+
+// Adds an empty cell to a column of a known type
+func (cb *columnBuilder) blank(i int) {
+	if cb.columnType(i) == ColumnString {
+		cb.streams[i].Strings = append(cb.streams[i].Strings, "")
+	} else {
+		cb.streams[i].Values = append(cb.streams[i].Values, math.NaN())
+	}
+}
+
+// Returns the streams of the columns that are not skipped
+// Values columns with empty cells get their own timing, made of the times of the rows they fill
+func (cb *columnBuilder) result(timing []time.Time) []Stream {
+	streams := []Stream{}
+	for i := range cb.streams {
+		if cb.columnType(i) == columnSkip {
+			continue
+		}
+		st := &cb.streams[i]
+		for ; cb.blanks[i] > 0; cb.blanks[i]-- {
+			st.Strings = append(st.Strings, "")
+		}
+		switch cb.columnType(i) {
+		case ColumnInteger:
+			st.Kind = KindInteger
+		case ColumnBoolean:
+			st.Kind = KindBoolean
+		case ColumnAuto:
+			if len(st.Values) < 1 || cb.decimals[i] {
+				break
+			}
+			if cb.words[i] && integerKind(st.Values) == KindBoolean {
+				st.Kind = KindBoolean
+			} else if cb.opts.DetectKinds {
+				st.Kind = integerKind(st.Values)
 			}
 		}
+		if sparse, ok := sparseStream(*st, timing, cb.gaps[i]); ok {
+			streams = append(streams, sparse)
+		}
+	}
+	return streams
+}
+
+// Parses a number, or a boolean as 0 or 1, and tells whether it was written with decimals
+// Numbers can have spaces around them, and use the separators of the options
+func parseCell(s string, opts CSVOptions) (float64, bool, error) {
+	s = strings.TrimSpace(s)
+	if booleanWord(s) {
+		if strings.EqualFold(s, "true") {
+			return 1, false, nil
+		}
+		return 0, false, nil
+	}
+	if opts.ThousandsSeparator != 0 {
+		s = strings.Replace(s, string(opts.ThousandsSeparator), "", -1)
+	}
+	if opts.DecimalSeparator != 0 && opts.DecimalSeparator != '.' {
+		if strings.Contains(s, ".") {
+			return 0, false, fmt.Errorf("Unexpected dot in %q", s)
+		}
+		s = strings.Replace(s, string(opts.DecimalSeparator), ".", -1)
 	}
+	val, err := strconv.ParseFloat(s, 64)
+	return val, strings.ContainsAny(s, ".eE"), err
+}
 
-	return streams, nil
+func booleanWord(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.EqualFold(s, "true") || strings.EqualFold(s, "false")
 }
 
-var utc *time.Location
+// Returns whether a column of numbers without decimals is made of integers or booleans (only 0 and 1)
+func integerKind(values []float64) Kind {
+	for _, v := range values {
+		if v != 0 && v != 1 && !math.IsNaN(v) {
+			return KindInteger
+		}
+	}
+	return KindBoolean
+}
+
+// Gives a values stream with empty cells its own timing, so that it keeps its native sample rate
+// Gaps stay in the stream as NaN. Streams without any value are left out
+func sparseStream(st Stream, timing []time.Time, gaps map[int]bool) (Stream, bool) {
+	sparse := false
+	for i, v := range st.Values {
+		if math.IsNaN(v) && !gaps[i] {
+			sparse = true
+			break
+		}
+	}
+	if !sparse {
+		return st, true
+	}
+	values := []float64{}
+	stTiming := []time.Time{}
+	for i, v := range st.Values {
+		if (!math.IsNaN(v) || gaps[i]) && i < len(timing) {
+			values = append(values, v)
+			stTiming = append(stTiming, timing[i])
+		}
+	}
+	st.Values = values
+	st.Timing = stTiming
+	return st, len(values) > 0
+}
+
+// Headers like "acceleration[x]" are dimensions of a multidimensional stream
+var dimensionHeader = regexp.MustCompile(`^(.+)\[[^\]]*\]$`)
+
+// Merges adjacent value streams labelled as dimensions of the same stream into array streams
+func groupDimensions(streams []Stream) []Stream {
+	grouped := []Stream{}
+
+	for i := 0; i < len(streams); i++ {
+		match := dimensionHeader.FindStringSubmatch(streams[i].Label)
+		if match == nil || len(streams[i].Values) < 1 {
+			grouped = append(grouped, streams[i])
+			continue
+		}
+		dimensions := []Stream{streams[i]}
+		for i+1 < len(streams) {
+			next := dimensionHeader.FindStringSubmatch(streams[i+1].Label)
+			if next == nil || next[1] != match[1] || len(streams[i+1].Values) != len(streams[i].Values) || !sameTiming(streams[i+1].Timing, streams[i].Timing) {
+				break
+			}
+			dimensions = append(dimensions, streams[i+1])
+			i++
+		}
+		if len(dimensions) < 2 {
+			grouped = append(grouped, streams[i])
+			continue
+		}
+		st := Stream{
+			Label:         strings.TrimSpace(match[1]),
+			Unit:          dimensions[0].Unit,
+			Interpolation: dimensions[0].Interpolation,
+			Arrays:        make([][]float64, len(dimensions[0].Values)),
+			Timing:        dimensions[0].Timing,
+		}
+		for j := range st.Arrays {
+			st.Arrays[j] = make([]float64, len(dimensions))
+			for d, dimension := range dimensions {
+				st.Arrays[j][d] = dimension.Values[j]
+			}
+		}
+		grouped = append(grouped, st)
+	}
+
+	return grouped
+}
 
 func millisecondsToTime(f float64) time.Time {
 	seconds := f / 1000
 	fullSeconds := math.Floor(seconds)
 	nanoseconds := (seconds - fullSeconds) * 1e+9
 	t := time.Unix(int64(fullSeconds), int64(nanoseconds))
-	return t.In(utc)
+	return t.In(time.UTC)
 }
 
-func floatsToTimes(xf []float64) []time.Time {
-	xt := []time.Time{}
-	for _, f := range xf {
-		mTime := millisecondsToTime(f)
-		xt = append(xt, mTime)
+// Replaces CR LF \r\n (windows) and CR \r (mac) with LF \n (unix) while reading
+type newlineReader struct {
+	r io.Reader
+	// Whether the last byte read was a CR, in case its LF comes in the next read
+	cr bool
+}
+
+func (nr *newlineReader) Read(p []byte) (int, error) {
+	n, err := nr.r.Read(p)
+	j := 0
+	for i := 0; i < n; i++ {
+		b := p[i]
+		if b == '\n' && nr.cr {
+			nr.cr = false
+			continue
+		}
+		nr.cr = b == '\r'
+		if nr.cr {
+			b = '\n'
+		}
+		p[j] = b
+		j++
 	}
-	return xt
+	return j, err
 }
 
-func normalizeNewlines(d []byte) []byte {
-	// replace CR LF \r\n (windows) with LF \n (unix)
-	d = bytes.Replace(d, []byte{13, 10}, []byte{10}, -1)
-	// replace CF \r (mac) with LF \n (unix)
-	d = bytes.Replace(d, []byte{13}, []byte{10}, -1)
-	return d
+// Delimiters that can be sniffed, in order of preference when they are equally frequent
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// Returns the most frequent delimiter out of quotes in a line
+// Decimal and thousands separators are not taken for delimiters
+func sniffDelimiter(line string, opts CSVOptions) rune {
+	counts := map[rune]int{}
+	quoted := false
+	for _, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if !quoted {
+			counts[r]++
+		}
+	}
+	// Ties go to the first allowed delimiter, in the order of delimiters
+	best := rune(0)
+	for _, d := range delimiters {
+		if d != opts.DecimalSeparator && d != opts.ThousandsSeparator && (best == 0 || counts[d] > counts[best]) {
+			best = d
+		}
+	}
+	return best
+}
+
+// Returns whether a line has cells, or is empty or a comment
+func dataLine(line string, opts CSVOptions) bool {
+	return len(line) > 0 && (opts.Comment == 0 || !strings.HasPrefix(line, string(opts.Comment)))
+}
+
+// ColumnType forces the type of a CSV column, which is detected from its cells by default
+type ColumnType int
+
+// Supported column types
+const (
+	ColumnAuto ColumnType = iota
+	// ColumnNumber reads a column as float numbers
+	ColumnNumber
+	// ColumnInteger reads a column as integers (see KindInteger)
+	ColumnInteger
+	// ColumnBoolean reads a column as booleans (see KindBoolean)
+	ColumnBoolean
+	// ColumnString reads a column as strings, even if its cells are numbers
+	ColumnString
+	// Time, date and excluded columns are not kept while reading
+	columnSkip ColumnType = -1
+)
+
+// Column contains the settings of a CSV column, to customize its stream
+type Column struct {
+	// Exclude drops the column
+	Exclude bool
+	// Label replaces the header as the label of the stream
+	Label string
+	// Type forces the type of the column
+	Type ColumnType
+	// Unit of the values, taken from the end of the label by default
+	Unit Unit
+	// Interpolation of the stream (see Stream)
+	Interpolation Interpolation
+}
+
+// CellPolicy decides what to do with cells that can't be read as numbers in values columns
+type CellPolicy int
+
+// Supported cell policies
+const (
+	// CellError returns a CSVError with the line and column of the cell. This is the default
+	CellError CellPolicy = iota
+	// CellGap keeps the cell as a gap (NaN), written according to Options.Gaps. Empty cells are left out instead
+	CellGap
+	// CellSkipRow drops the whole row
+	CellSkipRow
+)
+
+// CSVOptions contains the settings of FromCSVWithOptions
+// Their zero values read the files supported by FromCSV
+type CSVOptions struct {
+	// FrameRate is used if timing data is not present, or to read a left-aligned "timecode" column
+	FrameRate float64
+	// Delimiter separates cells. By default, it is sniffed from the first line: comma, semicolon, tab or pipe
+	Delimiter rune
+	// DecimalSeparator of numbers, a dot by default. Use a comma for "12,5"
+	DecimalSeparator rune
+	// ThousandsSeparator is removed from numbers, like the dots of "1.234,5". None by default
+	ThousandsSeparator rune
+	// Comment starts lines that are ignored, like '#' in the preamble of some loggers. None by default
+	Comment rune
+	// TimeColumn is the header of the column with the times. By default, a left-aligned column is used
+	// if its header is "milliseconds", "seconds", "time", "timestamp", "timecode", "frames"... or "date" followed by "time"
+	TimeColumn string
+	// TimeIndex selects the time column by its position, from 1, instead of by its header. It is the only way to pick
+	// the time column of a file without headers
+	TimeIndex int
+	// TimeFormat of the time column, detected from its header and values by default
+	TimeFormat TimeFormat
+	// TimeLayout parses timestamps with a custom layout of the time package, like "02/01/2006 15:04:05"
+	TimeLayout string
+	// DateColumn is the header of a column with the dates of relative times, like the times of the day of TimeClock
+	DateColumn string
+	// DateLayout parses the date column, "2006-01-02" by default
+	DateLayout string
+	// Location of the times and dates without a time zone. UTC by default
+	Location *time.Location
+	// Columns customizes the columns with these headers
+	Columns map[string]Column
+	// ExcludeOthers drops the columns that are not in Columns, except the time columns
+	ExcludeOthers bool
+	// DetectKinds reads columns of numbers without decimals as integers, or as booleans if they only
+	// contain 0 and 1 (see Kind). Otherwise they are floats, unless their Column.Type is set
+	DetectKinds bool
+	// Unparsable decides what to do with cells that can't be read as numbers in values columns
+	// Rows with times that can't be read return an error with CellError, or are skipped
+	Unparsable CellPolicy
+	// MaxRows stops reading after this number of rows with data. All by default
+	MaxRows int
+	// From and To select a time window, relative to the time of the first row. Rows before From are skipped,
+	// and reading stops at the first row after To, so times must be in order. The whole file by default
+	From time.Duration
+	To   time.Duration
+}
+
+// Applies the settings of the columns to their streams, dropping the excluded ones
+func applyColumns(streams []Stream, opts CSVOptions) []Stream {
+	result := []Stream{}
+	for _, st := range streams {
+		column, ok := opts.Columns[st.Label]
+		if column.Exclude || (!ok && opts.ExcludeOthers) {
+			continue
+		}
+		if column.Label != "" {
+			st.Label = column.Label
+			st.Unit = labelUnit(column.Label)
+		}
+		if column.Unit != "" {
+			st.Unit = column.Unit
+		}
+		if column.Interpolation != InterpolationDefault {
+			st.Interpolation = column.Interpolation
+		}
+		result = append(result, st)
+	}
+	return result
 }
 
 // FromCSV formats a compatible CSV as a FormattedData struct ready for mgJSON and returns it. Or returns an error
-// The optional frame rate (fr) is used if timing data is not present
+// The optional frame rate (fr) is used if timing data is not present, or to read a left-aligned "timecode" column
+// Adjacent columns with headers like "label[x]", "label[y]" are grouped as a multidimensional stream
+// Values columns with empty cells get their own timing, made of the times of the filled cells only
+// Cells read as gaps with CellGap are kept, so that Options.Gaps applies to them
 func FromCSV(src []byte, fr float64) (FormattedData, error) {
+	return FromCSVWithOptions(src, CSVOptions{FrameRate: fr})
+}
+
+// FromCSVWithOptions works like FromCSV, with the settings of CSVOptions
+// A UTF-8 byte order mark at the start of the file is ignored, and quoted numbers are read as numbers
+func FromCSVWithOptions(src []byte, opts CSVOptions) (FormattedData, error) {
+	return FromCSVReader(bytes.NewReader(src), opts)
+}
+
+// FromCSVReader works like FromCSVWithOptions, reading the file row by row, so that big files
+// only take the memory of their columns. It can stop early with the MaxRows, From and To options
+func FromCSVReader(r io.Reader, opts CSVOptions) (FormattedData, error) {
 	var data FormattedData
+	fr := opts.FrameRate
 
-	r := csv.NewReader(strings.NewReader(string(normalizeNewlines(src))))
-	lines, err := r.ReadAll()
-	if err != nil {
-		return data, err
+	decimal := opts.DecimalSeparator
+	if decimal == 0 {
+		decimal = '.'
 	}
+	if opts.ThousandsSeparator == decimal {
+		return data, fmt.Errorf("%w: the thousands and decimal separators are both %q", ErrInvalidOption, decimal)
+	}
+
+	br := bufio.NewReader(&newlineReader{r: r})
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+
+	var src io.Reader = br
+	comma := opts.Delimiter
+	if comma == 0 {
+		// The lines read to sniff the delimiter are read again by the CSV reader
+		var preamble bytes.Buffer
+		for {
+			line, err := br.ReadString('\n')
+			preamble.WriteString(line)
+			if err != nil && err != io.EOF {
+				return data, err
+			}
+			if dataLine(strings.TrimSuffix(line, "\n"), opts) || err == io.EOF {
+				comma = sniffDelimiter(line, opts)
+				break
+			}
+		}
+		src = io.MultiReader(&preamble, br)
+	}
+
+	cr := csv.NewReader(src)
+	cr.Comma = comma
+	cr.Comment = opts.Comment
+	cr.ReuseRecord = true
 
-	utc, err = time.LoadLocation("UTC")
+	record, err := cr.Read()
+	if err == io.EOF {
+		return data, ErrNoData
+	}
 	if err != nil {
 		return data, err
 	}
+	// Line in the file where the current record starts, counting comments and blank lines
+	line, _ := cr.FieldPos(0)
 
 	//check if first line is headers
-	if _, err := strconv.ParseFloat(lines[0][0], 64); err != nil {
-		headers := lines[0]
-		lines = lines[1:]
-		streams, err := structureData(headers, lines)
+	var headers, pending []string
+	column, date := -1, -1
+	var tr *timeReader
+	if _, _, err := parseCell(record[0], opts); err != nil {
+		headers = append(headers, record...)
+		var ok bool
+		column, date, ok, err = timeColumns(headers, opts)
 		if err != nil {
 			return data, err
 		}
-		if headers[0] == "milliseconds" && len(headers[1]) > 1 {
-			data.Timing = floatsToTimes(streams[0].Values)
-			streams = streams[1:]
-			headers = headers[1:]
+		if ok {
+			tr = newTimeReader(headers[column], date >= 0, opts)
+		} else {
+			column, date = -1, -1
+		}
+
+		// A column found by its header is only the time column if its first cell can be read as a time
+		if tr != nil && opts.TimeColumn == "" && opts.TimeIndex <= 0 {
+			tr.auto = true
+			record, err = cr.Read()
+			if err != nil && err != io.EOF {
+				return data, err
+			}
+			if err == nil {
+				pending = record
+				line, _ = cr.FieldPos(0)
+				var d string
+				if date >= 0 {
+					d = record[date]
+				}
+				if _, err := tr.read(record[column], d); err != nil {
+					if fr <= 0 {
+						return data, &CSVError{Line: line, Column: headers[column], Err: err}
+					}
+					tr = nil
+					column, date = -1, -1
+				}
+			}
 		}
-		data.Streams = streams
 	} else {
-		streams, err := structureData([]string{"Data"}, lines)
-		if err != nil {
-			return data, err
+		// Columns without headers are labelled "Data", "Data 2"...
+		headers = []string{"Data"}
+		for i := 2; i <= len(record); i++ {
+			headers = append(headers, fmt.Sprintf("Data %d", i))
+		}
+		pending = record
+
+		// Without headers, the time column can only be picked by its position
+		if opts.TimeColumn != "" || opts.DateColumn != "" {
+			return data, fmt.Errorf("%w: time and date columns can't be found by header in a file without headers", ErrNoTiming)
+		}
+		if opts.TimeIndex > 0 {
+			if opts.TimeIndex > len(headers) {
+				return data, fmt.Errorf("%w: no time column at position %d", ErrNoTiming, opts.TimeIndex)
+			}
+			column = opts.TimeIndex - 1
+			tr = newTimeReader(headers[column], false, opts)
 		}
-		data.Streams = streams
 	}
 
-	if len(data.Streams) < 1 {
-		return data, fmt.Errorf("No valid data found")
+	if tr == nil && fr <= 0 {
+		return data, fmt.Errorf("%w: the file has no times and the frame rate is %v", ErrNoTiming, fr)
 	}
 
-	if len(data.Timing) < 1 {
-		for i := 0; i < len(data.Streams[0].Values); i++ {
-			data.Timing = append(data.Timing, millisecondsToTime(float64(i)*1000.0/fr))
+	cb := newColumnBuilder(headers, opts)
+	for _, i := range []int{column, date} {
+		if i >= 0 {
+			cb.types[i] = columnSkip
+		}
+	}
+
+	rows := 0
+	var first time.Time
+	started := false
+	for {
+		row := pending
+		pending = nil
+		if row == nil {
+			row, err = cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return data, err
+			}
+			line, _ = cr.FieldPos(0)
+		}
+		rows++
+
+		var t time.Time
+		if tr != nil {
+			var d string
+			if date >= 0 {
+				d = row[date]
+			}
+			t, err = tr.read(row[column], d)
+			if err != nil {
+				if opts.Unparsable == CellError {
+					return data, &CSVError{Line: line, Column: headers[column], Err: err}
+				}
+				continue
+			}
+		} else {
+			t = millisecondsToTime(float64(rows-1) * 1000 / fr)
+		}
+
+		if opts.From != 0 || opts.To != 0 {
+			if !started {
+				first = t
+				started = true
+			}
+			if opts.To > 0 && t.Sub(first) > opts.To {
+				break
+			}
+			if t.Sub(first) < opts.From {
+				continue
+			}
 		}
+
+		added, err := cb.add(row, line)
+		if err != nil {
+			return data, err
+		}
+		if added {
+			data.Timing = append(data.Timing, t)
+			if opts.MaxRows > 0 && len(data.Timing) >= opts.MaxRows {
+				break
+			}
+		}
+	}
+
+	data.Streams = groupDimensions(applyColumns(cb.result(data.Timing), opts))
+
+	if len(data.Streams) < 1 || len(data.Timing) < 1 {
+		return data, ErrNoData
 	}
 
 	return data, nil
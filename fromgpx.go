@@ -4,8 +4,8 @@ import (
 	"encoding/xml"
 	"fmt"
 	"math"
-	"time"
 	"strconv"
+	"time"
 )
 
 func degreesToRadians(degrees float64) float64 {
@@ -79,10 +79,26 @@ var ids = []string{
 	"verticalAcceleration (m/s²)",
 	"course (°)",
 	"slope (°)",
+	// Multidimensional streams
+	"position (°)",
 	// Additional explicit date string
 	"time",
 }
 
+// Streams computed from the position, elevation and time
+var computed = []string{
+	"distance2d (m)",
+	"distance3d (m)",
+	"verticalSpeed (m/s)",
+	"speed2d (m/s)",
+	"speed3d (m/s)",
+	"acceleration2d (m/s²)",
+	"acceleration3d (m/s²)",
+	"verticalAcceleration (m/s²)",
+	"course (°)",
+	"slope (°)",
+}
+
 // Return index of stream
 func idx(item string) int {
 	for i, v := range ids {
@@ -100,12 +116,38 @@ func appendToFloatStream(data FormattedData, v *float64, n string) Stream {
 		// Name confirmed streams
 		st.Label = n
 	} else {
-		// Appending zeros for now, could potentially add interpolated values based on previous, next and time
-		st.Values = append(st.Values, 0)
+		// Missing values are gaps, handled by ToMgjson according to its gap policy
+		st.Values = append(st.Values, math.NaN())
 	}
 	return st
 }
 
+// Returns the last value of a stream before index i that is not a gap, or zero
+func lastKnown(st Stream, i int) float64 {
+	if j := lastKnownIndex(st, i); j >= 0 {
+		return st.Values[j]
+	}
+	return 0
+}
+
+// Returns the index of the last value of a stream before index i that is not a gap, or -1
+func lastKnownIndex(st Stream, i int) int {
+	for j := i - 1; j >= 0; j-- {
+		if !math.IsNaN(st.Values[j]) {
+			return j
+		}
+	}
+	return -1
+}
+
+func appendToArrayStream(data FormattedData, a []float64, n string) Stream {
+	st := data.Streams[idx(n)]
+	st.Arrays = append(st.Arrays, a)
+	// Name confirmed streams
+	st.Label = n
+	return st
+}
+
 func appendToStringStream(data FormattedData, s *string, n string) Stream {
 	st := data.Streams[idx(n)]
 	st.Strings = append(st.Strings, *s)
@@ -115,6 +157,9 @@ func appendToStringStream(data FormattedData, s *string, n string) Stream {
 }
 
 func stringFirstNumber(s string) (float64, bool) {
+	if len(s) < 1 {
+		return 0, false
+	}
 	n, err := strconv.ParseFloat(s[:1], 64)
 	if err != nil {
 		return 0, false
@@ -122,15 +167,42 @@ func stringFirstNumber(s string) (float64, bool) {
 	return n, true
 }
 
+// GPXOptions contains the settings of FromGPXWithOptions
+type GPXOptions struct {
+	// Extra computes additional streams based on the existing data
+	Extra bool
+	// Location converts times, including the "time" string stream, to a time zone. UTC by default
+	Location *time.Location
+	// KeepOffset keeps times in the UTC offset written in the file, like "+09:00", instead of converting them
+	// It takes precedence over Location
+	KeepOffset bool
+	// Units converts the streams of some units to others, like {UnitMeterPerSecond: UnitKilometerPerHour}
+	Units map[Unit]Unit
+}
+
 // FromGPX formats a compatible GPX file as a struct ready for mgJSON and returns it. Or returns an error
 // The optional extra bool will compute additional streams based on the existing data
+// A 2D position stream (lat, lon) that can be linked to a Point property is always added
+// Named waypoints with a time are exported as event markers
+// Streams carry the unit of their label, so that they can be converted with ConvertUnits
 func FromGPX(src []byte, extra bool) (FormattedData, error) {
+	return FromGPXWithOptions(src, GPXOptions{Extra: extra})
+}
+
+// FromGPXWithOptions works like FromGPX, with the settings of GPXOptions
+func FromGPXWithOptions(src []byte, opts GPXOptions) (FormattedData, error) {
 
 	var data FormattedData
 
-	utc, err := time.LoadLocation("UTC")
-	if err != nil {
-		return data, err
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := func(t time.Time) time.Time {
+		if opts.KeepOffset {
+			return t
+		}
+		return t.In(loc)
 	}
 
 	type Trkpt struct {
@@ -157,28 +229,55 @@ func FromGPX(src []byte, extra bool) (FormattedData, error) {
 
 	type Trk struct {
 		XMLName xml.Name `xml:"trk"`
+		Name    *string  `xml:"name"`
+		Desc    *string  `xml:"desc"`
+		Src     *string  `xml:"src"`
 		Trkseg  []Trkseg `xml:"trkseg"`
 	}
 
+	type Wpt struct {
+		XMLName xml.Name `xml:"wpt"`
+		Time    *string  `xml:"time"`
+		Name    *string  `xml:"name"`
+	}
+
 	type Gpx struct {
 		XMLName xml.Name `xml:"gpx"`
+		Wpt     []Wpt    `xml:"wpt"`
 		Trk     []Trk    `xml:"trk"`
 	}
 
 	gpx := Gpx{}
 
-	err = xml.Unmarshal(src, &gpx)
+	err := xml.Unmarshal(src, &gpx)
 	if err != nil {
 		return data, err
 	}
 
 	if len(gpx.Trk) < 1 {
-		return data, fmt.Errorf("Error: No GPX tracks")
+		return data, fmt.Errorf("%w: no tracks", ErrNotEnoughPoints)
 	}
 
 	// Just reading one track for now
 	if len(gpx.Trk[0].Trkseg) < 1 {
-		return data, fmt.Errorf("Error: No GPX trkseg")
+		return data, fmt.Errorf("%w: no trkseg", ErrNotEnoughPoints)
+	}
+
+	// Track metadata does not change over time
+	for _, field := range []struct {
+		label string
+		value *string
+	}{
+		{"name", gpx.Trk[0].Name},
+		{"desc", gpx.Trk[0].Desc},
+		{"src", gpx.Trk[0].Src},
+	} {
+		if field.value != nil && len(*field.value) > 0 {
+			data.Statics = append(data.Statics, Static{
+				Label:  field.label,
+				String: field.value,
+			})
+		}
 	}
 
 	trkpts := []Trkpt{}
@@ -188,7 +287,7 @@ func FromGPX(src []byte, extra bool) (FormattedData, error) {
 	}
 
 	if len(trkpts) < 2 {
-		return data, fmt.Errorf("Error: Not enough GPX trkpt")
+		return data, fmt.Errorf("%w: fewer than two trkpt", ErrNotEnoughPoints)
 	}
 
 	// One Stream for each of the supported trkpt and custom fields
@@ -201,14 +300,14 @@ func FromGPX(src []byte, extra bool) (FormattedData, error) {
 
 	for i, trkpt := range trkpts {
 		if trkpt.Time == nil {
-			return data, fmt.Errorf("Error: Missing timiing data in GPX")
+			return data, &GPXError{Trkpt: i, Err: ErrMissingTime}
 		}
 		t, err := time.Parse(time.RFC3339, *trkpt.Time)
 		if err != nil {
-			return data, err
+			return data, &GPXError{Trkpt: i, Err: err}
 		}
 
-		t = t.In(utc)
+		t = local(t)
 
 		data.Timing[i] = t
 		data.Streams[idx("lat (°)")] = appendToFloatStream(data, trkpt.Lat, "lat (°)")
@@ -216,12 +315,14 @@ func FromGPX(src []byte, extra bool) (FormattedData, error) {
 		data.Streams[idx("ele (m)")] = appendToFloatStream(data, trkpt.Ele, "ele (m)")
 		data.Streams[idx("magvar (°)")] = appendToFloatStream(data, trkpt.Magvar, "magvar (°)")
 		data.Streams[idx("geoidheight (m)")] = appendToFloatStream(data, trkpt.Geoidheight, "geoidheight (m)")
+		var fixNum *float64
 		if trkpt.Fix != nil {
-			fixNum, validFixNum := stringFirstNumber(*trkpt.Fix)
+			n, validFixNum := stringFirstNumber(*trkpt.Fix)
 			if validFixNum {
-				data.Streams[idx("fix")] = appendToFloatStream(data, &fixNum, "fix")
+				fixNum = &n
 			}
 		}
+		data.Streams[idx("fix")] = appendToFloatStream(data, fixNum, "fix")
 		data.Streams[idx("sat")] = appendToFloatStream(data, trkpt.Sat, "sat")
 		data.Streams[idx("hdop")] = appendToFloatStream(data, trkpt.Hdop, "hdop")
 		data.Streams[idx("vdop")] = appendToFloatStream(data, trkpt.Vdop, "vdop")
@@ -229,10 +330,15 @@ func FromGPX(src []byte, extra bool) (FormattedData, error) {
 		data.Streams[idx("ageofdgpsdata (s)")] = appendToFloatStream(data, trkpt.Ageofdgpsdata, "ageofdgpsdata (s)")
 		data.Streams[idx("dgpsid")] = appendToFloatStream(data, trkpt.Dgpsid, "dgpsid")
 
-		data.Streams[idx("time")] = appendToStringStream(data, trkpt.Time, "time")
+		if opts.Location != nil && !opts.KeepOffset {
+			localTime := t.Format("2006-01-02T15:04:05.000Z07:00")
+			data.Streams[idx("time")] = appendToStringStream(data, &localTime, "time")
+		} else {
+			data.Streams[idx("time")] = appendToStringStream(data, trkpt.Time, "time")
+		}
 
 		// Computed streams
-		if extra && trkpt.Lat != nil && trkpt.Lon != nil {
+		if opts.Extra && trkpt.Lat != nil && trkpt.Lon != nil {
 			var distance2d float64
 			var speed2d float64
 			var acceleration2d float64
@@ -243,6 +349,10 @@ func FromGPX(src []byte, extra bool) (FormattedData, error) {
 			var acceleration3d float64
 			var verticalSpeed float64
 			var verticalAcceleration float64
+			if trkpt.Ele == nil {
+				nan := math.NaN()
+				slope, verticalSpeed, verticalAcceleration = nan, nan, nan
+			}
 			if i > 0 {
 				prevLat := data.Streams[idx("lat (°)")].Values[i-1]
 				prevLon := data.Streams[idx("lon (°)")].Values[i-1]
@@ -252,31 +362,36 @@ func FromGPX(src []byte, extra bool) (FormattedData, error) {
 				duration = math.Max(duration, 1e-9)
 				speed2d = distance2d / duration
 				acceleration2d = speed2d
-				prevCourse := data.Streams[idx("course (°)")].Values[i-1]
+				prevCourse := lastKnown(data.Streams[idx("course (°)")], i)
 				course = angleFromCoordinate(*trkpt.Lat, *trkpt.Lon, prevLat, prevLon, prevCourse)
+				// While the elevation is unknown only the horizontal distance counts,
+				// and the climb since the last known elevation is added when it comes back
+				distance3d = distance2d
 				if trkpt.Ele != nil {
-					prevEle := data.Streams[idx("ele (m)")].Values[i-1]
-					verticalDist := *trkpt.Ele - prevEle
+					eles := data.Streams[idx("ele (m)")]
+					if j := lastKnownIndex(eles, i); j >= 0 {
+						distance3d = math.Sqrt(math.Pow(*trkpt.Ele-eles.Values[j], 2) + math.Pow(distance2d, 2))
+					}
+					verticalDist := *trkpt.Ele - eles.Values[i-1]
 					slope = math.Atan2(verticalDist, distance2d)
 					slope = radiansToDegrees(slope)
-					distance3d = math.Sqrt(math.Pow(verticalDist, 2) + math.Pow(distance2d, 2))
-					speed3d = distance3d / duration
-					acceleration3d = speed3d
 					verticalSpeed = verticalDist / duration
 					verticalAcceleration = verticalSpeed
 				}
+				speed3d = distance3d / duration
+				acceleration3d = speed3d
 				if i > 1 {
-					prevDistance := data.Streams[idx("distance2d (m)")].Values[i-1]
+					prevDistance := lastKnown(data.Streams[idx("distance2d (m)")], i)
 					distance2d += prevDistance
 					prevSpeed2d := data.Streams[idx("speed2d (m/s)")].Values[i-1]
 					speed2dChange := speed2d - prevSpeed2d
 					acceleration2d = speed2dChange / duration
+					prevDistance3d := lastKnown(data.Streams[idx("distance3d (m)")], i)
+					distance3d += prevDistance3d
+					prevSpeed3d := data.Streams[idx("speed3d (m/s)")].Values[i-1]
+					speed3dChange := speed3d - prevSpeed3d
+					acceleration3d = speed3dChange / duration
 					if trkpt.Ele != nil {
-						prevDistance3d := data.Streams[idx("distance3d (m)")].Values[i-1]
-						distance3d += prevDistance3d
-						prevSpeed3d := data.Streams[idx("speed3d (m/s)")].Values[i-1]
-						speed3dChange := speed3d - prevSpeed3d
-						acceleration3d = speed3dChange / duration
 						prevVerticalSpeed := data.Streams[idx("verticalSpeed (m/s)")].Values[i-1]
 						verticalSpeedChange := verticalSpeed - prevVerticalSpeed
 						verticalAcceleration = verticalSpeedChange / duration
@@ -294,16 +409,61 @@ func FromGPX(src []byte, extra bool) (FormattedData, error) {
 			data.Streams[idx("acceleration3d (m/s²)")] = appendToFloatStream(data, &acceleration3d, "acceleration3d (m/s²)")
 			data.Streams[idx("verticalSpeed (m/s)")] = appendToFloatStream(data, &verticalSpeed, "verticalSpeed (m/s)")
 			data.Streams[idx("verticalAcceleration (m/s²)")] = appendToFloatStream(data, &verticalAcceleration, "verticalAcceleration (m/s²)")
+		} else if opts.Extra {
+			// Keep computed streams aligned with the timing
+			for _, n := range computed {
+				data.Streams[idx(n)] = appendToFloatStream(data, nil, n)
+			}
+		}
+
+		// The position is read rather than computed, so it does not depend on Extra
+		if trkpt.Lat != nil && trkpt.Lon != nil {
+			data.Streams[idx("position (°)")] = appendToArrayStream(data, []float64{*trkpt.Lat, *trkpt.Lon}, "position (°)")
+		} else {
+			data.Streams[idx("position (°)")].Arrays = append(data.Streams[idx("position (°)")].Arrays, []float64{math.NaN(), math.NaN()})
 		}
 	}
 
+	// Discrete fields are integers, so they are not interpolated
+	for _, n := range []string{"fix", "sat", "dgpsid"} {
+		data.Streams[idx(n)].Kind = KindInteger
+	}
+
 	// Clean up unconfirmed streams
 	for i := len(data.Streams) - 1; i >= 0; i-- {
 		if len(data.Streams[i].Label) < 1 {
 			copy(data.Streams[i:], data.Streams[i+1:])
 			data.Streams[len(data.Streams)-1] = Stream{}
 			data.Streams = data.Streams[:len(data.Streams)-1]
+		} else {
+			data.Streams[i].Unit = labelUnit(data.Streams[i].Label)
+		}
+	}
+
+	// Timed waypoints become a sparse stream of event markers
+	waypoints := Stream{
+		Label:       "waypoints",
+		EventMarker: true,
+	}
+
+	for _, wpt := range gpx.Wpt {
+		if wpt.Time == nil || wpt.Name == nil || *wpt.Name == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, *wpt.Time)
+		if err != nil {
+			return data, &GPXError{Waypoint: *wpt.Name, Err: err}
 		}
+		waypoints.Strings = append(waypoints.Strings, *wpt.Name)
+		waypoints.Timing = append(waypoints.Timing, local(t))
+	}
+
+	if len(waypoints.Strings) > 0 {
+		data.Streams = append(data.Streams, waypoints)
+	}
+
+	if opts.Units != nil {
+		return ConvertUnits(data, opts.Units)
 	}
 
 	return data, nil
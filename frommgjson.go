@@ -0,0 +1,348 @@
+package tomgjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// An entry of the mgJSON outline, whichever its object type
+type outlineEntry struct {
+	ObjectType    string          `json:"objectType"`
+	DisplayName   string          `json:"displayName"`
+	SampleSetID   string          `json:"sampleSetID"`
+	DataType      dataType        `json:"dataType"`
+	Interpolation Interpolation   `json:"interpolation"`
+	SampleCount   int             `json:"sampleCount"`
+	MatchName     string          `json:"matchName"`
+	Value         json.RawMessage `json:"value"`
+	Children      []outlineEntry  `json:"children"`
+}
+
+type rawSample struct {
+	Time  string          `json:"time"`
+	Value json.RawMessage `json:"value"`
+}
+
+type rawDynamicSample struct {
+	SampleSetID string      `json:"sampleSetID"`
+	Samples     []rawSample `json:"samples"`
+}
+
+type rawMgjson struct {
+	DynamicDataInfo    dynamicDataInfo    `json:"dynamicDataInfo"`
+	DataOutline        []outlineEntry     `json:"dataOutline"`
+	DataDynamicSamples []rawDynamicSample `json:"dataDynamicSamples"`
+}
+
+// Parses a padded number like "+002.50"
+func parsePaddedNumber(raw json.RawMessage) (float64, error) {
+	var s string
+	err := json.Unmarshal(raw, &s)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Parses a padded array like ["+41.38", "+02.14"]
+func parsePaddedArray(raw json.RawMessage) ([]float64, error) {
+	var xs []string
+	err := json.Unmarshal(raw, &xs)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]float64, len(xs))
+	for i, s := range xs {
+		a[i], err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Parses a padded string, removing the padding according to its length in UTF-16 code units
+func parsePaddedString(raw json.RawMessage) (string, error) {
+	var v paddedStringValue
+	err := json.Unmarshal(raw, &v)
+	if err != nil {
+		return "", err
+	}
+	length, err := strconv.Atoi(v.Length)
+	if err != nil {
+		return "", err
+	}
+	s, ok := stringPrefix(v.Str, length)
+	if !ok {
+		return "", fmt.Errorf("%w: padded string length %q out of range", ErrMalformed, v.Length)
+	}
+	return s, nil
+}
+
+// Returns the display overrides needed to reproduce a pattern that can't be computed from the values
+// and a legal range that differs from the occurring one
+func displayFromPattern(p pattern, r mRange, compute func(Display) pattern) Display {
+	display := Display{Unsigned: !p.IsSigned}
+
+	computed := compute(display)
+	if computed.DigitsDecimal != p.DigitsDecimal {
+		decimals := p.DigitsDecimal
+		display.DecimalDigits = &decimals
+		computed = compute(display)
+	}
+	if computed.DigitsInteger != p.DigitsInteger {
+		display.IntegerDigits = p.DigitsInteger
+	}
+	if r.Legal != r.Occuring {
+		display.Legal = &Range{r.Legal.Min, r.Legal.Max}
+	}
+
+	return display
+}
+
+// Returns the display overrides of numbers
+func numberDisplay(values []float64, p pattern, r mRange) Display {
+	return displayFromPattern(p, r, func(display Display) pattern {
+		computed, _, _ := numberPattern(values, display)
+		return computed
+	})
+}
+
+// Walks the outline and rebuilds the tree of a FormattedData
+type outlineReader struct {
+	samples   map[string][]rawSample
+	parseTime func(string) (time.Time, error)
+	// Timing of the first stream, shared with the rest of streams that match it
+	timing []time.Time
+}
+
+func (r *outlineReader) stream(entry outlineEntry) (Stream, error) {
+	st := Stream{ID: entry.MatchName, Label: entry.DisplayName, Unit: labelUnit(entry.DisplayName)}
+
+	samples, ok := r.samples[entry.SampleSetID]
+	if !ok {
+		return st, fmt.Errorf("%w: missing samples of %q", ErrMalformed, entry.SampleSetID)
+	}
+
+	timing := make([]time.Time, len(samples))
+	for i, s := range samples {
+		t, err := r.parseTime(s.Time)
+		if err != nil {
+			return st, err
+		}
+		timing[i] = t
+	}
+
+	var defaultInterpolation Interpolation
+
+	switch entry.DataType.Type {
+	case "numberString":
+		st.Values = make([]float64, len(samples))
+		for i, s := range samples {
+			v, err := parsePaddedNumber(s.Value)
+			if err != nil {
+				return st, err
+			}
+			st.Values[i] = v
+		}
+		properties := entry.DataType.NumberStringProperties
+		st.Display = numberDisplay(st.Values, properties.Pattern, properties.Range)
+		defaultInterpolation = InterpolationLinear
+	case "paddedString":
+		st.Strings = make([]string, len(samples))
+		for i, s := range samples {
+			v, err := parsePaddedString(s.Value)
+			if err != nil {
+				return st, err
+			}
+			st.Strings[i] = v
+		}
+		st.EventMarker = entry.DataType.PaddedStringProperties.EventMarkerB
+		defaultInterpolation = InterpolationHold
+	case "numberStringArray":
+		properties := entry.DataType.NumberArrayProperties
+		if properties == nil {
+			return st, fmt.Errorf("%w: missing array properties of %q", ErrMalformed, entry.SampleSetID)
+		}
+		st.Arrays = make([][]float64, len(samples))
+		for i, s := range samples {
+			a, err := parsePaddedArray(s.Value)
+			if err != nil {
+				return st, err
+			}
+			if len(a) < 1 || len(a) != properties.ArraySize {
+				return st, fmt.Errorf("%w: sample %d has %d dimensions, arraySize is %d", ErrMalformed, i, len(a), properties.ArraySize)
+			}
+			st.Arrays[i] = a
+		}
+		if len(st.Arrays) > 0 && len(properties.ArrayRanges.Ranges) > 0 {
+			// The legal range can only be overridden for all dimensions at once
+			st.Display = displayFromPattern(properties.Pattern, properties.ArrayRanges.Ranges[0], func(display Display) pattern {
+				_, computed, _ := arrayDataType(st.Arrays, display)
+				return computed
+			})
+		}
+		defaultInterpolation = InterpolationLinear
+	default:
+		return st, fmt.Errorf("%w: data type %q", ErrUnsupported, entry.DataType.Type)
+	}
+
+	if entry.Interpolation != defaultInterpolation {
+		st.Interpolation = entry.Interpolation
+	}
+
+	if r.timing == nil {
+		r.timing = timing
+	} else if !sameTiming(r.timing, timing) {
+		st.Timing = timing
+	}
+
+	return st, nil
+}
+
+func (r *outlineReader) static(entry outlineEntry) (Static, error) {
+	static := Static{ID: entry.MatchName, Label: entry.DisplayName}
+
+	switch entry.DataType.Type {
+	case "numberString":
+		v, err := parsePaddedNumber(entry.Value)
+		if err != nil {
+			return static, err
+		}
+		properties := entry.DataType.NumberStringProperties
+		static.Value = &v
+		static.Display = numberDisplay([]float64{v}, properties.Pattern, properties.Range)
+	case "paddedString":
+		s, err := parsePaddedString(entry.Value)
+		if err != nil {
+			return static, err
+		}
+		static.String = &s
+	default:
+		return static, fmt.Errorf("%w: static data type %q", ErrUnsupported, entry.DataType.Type)
+	}
+
+	return static, nil
+}
+
+// Returns the streams, static fields and groups of one level of the outline
+func (r *outlineReader) read(entries []outlineEntry) ([]Stream, []Static, []Group, error) {
+	streams := []Stream{}
+	statics := []Static{}
+	groups := []Group{}
+
+	for _, entry := range entries {
+		switch entry.ObjectType {
+		case "dataDynamic":
+			st, err := r.stream(entry)
+			if err != nil {
+				return nil, nil, nil, &StreamError{Label: entry.DisplayName, Err: err}
+			}
+			streams = append(streams, st)
+		case "dataStatic":
+			static, err := r.static(entry)
+			if err != nil {
+				return nil, nil, nil, &StreamError{Label: entry.DisplayName, Err: err}
+			}
+			statics = append(statics, static)
+		case "dataGroup":
+			group := Group{Label: entry.DisplayName}
+			var err error
+			group.Streams, group.Statics, group.Groups, err = r.read(entry.Children)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			groups = append(groups, group)
+		default:
+			return nil, nil, nil, fmt.Errorf("%w: object type %q", ErrUnsupported, entry.ObjectType)
+		}
+	}
+
+	return streams, statics, groups, nil
+}
+
+func parseDocumentTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// Returns a parser of the timecodes of a document, relative to the Unix epoch
+func timecodeParser(info *timecodeInfo) (func(string) (time.Time, error), error) {
+	if info == nil {
+		return nil, fmt.Errorf("%w: missing timecode info", ErrMalformed)
+	}
+	tc := Timecode{FrameRate: info.FrameRate}
+	err := tc.validate()
+	if err != nil {
+		return nil, err
+	}
+	return func(s string) (time.Time, error) {
+		d, err := tc.parse(s)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, 0).UTC().Add(d), nil
+	}, nil
+}
+
+func sameTiming(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// FromMgjson parses an mgJSON document back into a FormattedData struct and returns it. Or returns an error
+// It supports dynamic, static and grouped numberString, paddedString and numberStringArray data
+// Streams that do not share the timing of the first stream keep their own Timing
+// Timecodes are read as times of the first day of the Unix epoch
+// Match names are kept as IDs, so that converting the result again keeps the links of After Effects projects
+func FromMgjson(src []byte) (FormattedData, error) {
+	var data FormattedData
+
+	doc := rawMgjson{}
+	err := json.Unmarshal(src, &doc)
+	if err != nil {
+		return data, err
+	}
+
+	r := outlineReader{
+		samples:   map[string][]rawSample{},
+		parseTime: parseDocumentTime,
+	}
+
+	if doc.DynamicDataInfo.UseTimecodeB {
+		r.parseTime, err = timecodeParser(doc.DynamicDataInfo.TimecodeInfo)
+		if err != nil {
+			return data, err
+		}
+	}
+
+	for _, set := range doc.DataDynamicSamples {
+		r.samples[set.SampleSetID] = set.Samples
+	}
+
+	streams, statics, groups, err := r.read(doc.DataOutline)
+	if err != nil {
+		return data, err
+	}
+
+	data.Timing = r.timing
+	if len(streams) > 0 {
+		data.Streams = streams
+	}
+	if len(statics) > 0 {
+		data.Statics = statics
+	}
+	if len(groups) > 0 {
+		data.Groups = groups
+	}
+
+	return data, nil
+}
@@ -1,3 +1,5 @@
 module github.com/juanirache/tomgjson
 
-go 1.13
+go 1.17
+
+require golang.org/x/text v0.13.0
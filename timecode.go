@@ -0,0 +1,111 @@
+package tomgjson
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Timecode makes ToMgjsonWithOptions and Encoder key samples by SMPTE timecode ("HH:MM:SS:FF") instead of UTC dates
+// Each sample gets the timecode of the frame that contains its time of day
+type Timecode struct {
+	// FrameRate of the footage, e.g. 25, 29.97 or 59.94
+	FrameRate float64
+	// DropFrame skips frame numbers to keep 29.97 and 59.94 timecode in sync with the clock ("HH:MM:SS;FF")
+	DropFrame bool
+}
+
+type timecodeInfo struct {
+	FrameRate  float64 `json:"frameRate"`
+	DropFrameB bool    `json:"dropFrameB"`
+}
+
+var timecodeFormat = regexp.MustCompile(`^(\d{2}):(\d{2}):(\d{2})([:;])(\d{2})$`)
+
+// Frames per second of the timecode labels, e.g. 30 for 29.97
+func (tc Timecode) nominal() int {
+	return int(math.Round(tc.FrameRate))
+}
+
+// Frame numbers skipped every minute, except every tenth minute
+func (tc Timecode) dropped() int {
+	if !tc.DropFrame {
+		return 0
+	}
+	return tc.nominal() / 15
+}
+
+func (tc Timecode) validate() error {
+	if tc.FrameRate <= 0 {
+		return fmt.Errorf("%w: timecode needs a frame rate", ErrInvalidOption)
+	}
+	if tc.nominal() < 1 {
+		return fmt.Errorf("%w: timecode frame rate %v is below 1 fps", ErrInvalidOption, tc.FrameRate)
+	}
+	if tc.DropFrame && tc.nominal()%30 != 0 {
+		return fmt.Errorf("%w: drop frame timecode only works with 29.97 and 59.94 fps", ErrInvalidOption)
+	}
+	return nil
+}
+
+// Formats the time of day of t as timecode
+func (tc Timecode) format(t time.Time) string {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	// Tolerance for frame boundaries that can't be represented exactly as floats
+	frame := int(math.Floor(t.Sub(midnight).Seconds()*tc.FrameRate + 1e-6))
+
+	separator := ":"
+	if drop := tc.dropped(); drop > 0 {
+		separator = ";"
+		framesPer10Minutes := int(math.Round(tc.FrameRate * 600))
+		framesPerMinute := tc.nominal()*60 - drop
+		tens := frame / framesPer10Minutes
+		rest := frame % framesPer10Minutes
+		frame += drop * 9 * tens
+		if rest > drop {
+			frame += drop * ((rest - drop) / framesPerMinute)
+		}
+	}
+
+	nominal := tc.nominal()
+	return fmt.Sprintf(
+		"%02d:%02d:%02d%v%02d",
+		frame/(nominal*3600)%24,
+		frame/(nominal*60)%60,
+		frame/nominal%60,
+		separator,
+		frame%nominal,
+	)
+}
+
+// Parses a timecode into the time elapsed since midnight
+// A semicolon separator means drop frame timecode
+func (tc Timecode) parse(s string) (time.Duration, error) {
+	match := timecodeFormat.FindStringSubmatch(s)
+	if match == nil {
+		return 0, fmt.Errorf("%w: badly formatted %q", ErrInvalidTimecode, s)
+	}
+
+	tc.DropFrame = match[4] == ";"
+	err := tc.validate()
+	if err != nil {
+		return 0, err
+	}
+
+	units := make([]int, 4)
+	for i, m := range []string{match[1], match[2], match[3], match[5]} {
+		units[i], _ = strconv.Atoi(m)
+	}
+	hours, minutes, seconds, frames := units[0], units[1], units[2], units[3]
+
+	if minutes > 59 || seconds > 59 || frames >= tc.nominal() {
+		return 0, fmt.Errorf("%w: %q out of range", ErrInvalidTimecode, s)
+	}
+
+	totalMinutes := hours*60 + minutes
+	frame := (totalMinutes*60+seconds)*tc.nominal() + frames - tc.dropped()*(totalMinutes-totalMinutes/10)
+
+	return time.Duration(math.Round(float64(frame) / tc.FrameRate * 1e9)), nil
+}
@@ -6,13 +6,16 @@
 package tomgjson
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // Like math.Max but with ints
@@ -24,13 +27,15 @@ func maxInt(a, b int) int {
 }
 
 // Returns both sides of a float number as strings
-func sides(n float64) (string, string) {
-	sides := strings.Split(strconv.FormatFloat(math.Abs(n), 'f', -1, 64), ".")
+// The number of decimals can be fixed, or -1 to use as many as needed (at least one)
+func sides(n float64, decimals int) (string, string) {
+	sides := strings.SplitN(strconv.FormatFloat(math.Abs(n), 'f', decimals, 64), ".", 2)
 	if len(sides) == 1 {
-		sides = append(sides, "0")
-	}
-	if len(sides) != 2 {
-		log.Panicf("Badly formatted float: %v %v", n, sides)
+		if decimals == 0 {
+			sides = append(sides, "")
+		} else {
+			sides = append(sides, "0")
+		}
 	}
 	return sides[0], sides[1]
 }
@@ -38,6 +43,13 @@ func sides(n float64) (string, string) {
 // Make sure float values are within mgJSON's valid values
 const largestMgjsonNum = 2147483648.0
 
+// Widest padding that Display can ask for. Integer parts never need more than the digits of largestMgjsonNum,
+// and float64 values have no more than 17 significant digits
+const (
+	maxIntegerDigits = 10
+	maxDecimalDigits = 17
+)
+
 func validValue(v float64) float64 {
 	if math.IsNaN(v) {
 		return 0
@@ -45,20 +57,141 @@ func validValue(v float64) float64 {
 	return math.Max(math.Min(v, largestMgjsonNum), -largestMgjsonNum)
 }
 
-// Stream contains a slice of values or strings and their label
-// The slices must be of the same length as the timing slice in their parent's FormattedData
-// Only one of the slices must be present, not both
+// Interpolation is the way After Effects computes the values between samples
+type Interpolation string
+
+const (
+	// InterpolationDefault is linear for numbers and arrays, and hold for strings
+	InterpolationDefault Interpolation = ""
+	// InterpolationLinear draws a straight line between samples
+	InterpolationLinear Interpolation = "linear"
+	// InterpolationHold keeps each value until the next sample, for step-like signals (gear, lap, satellites...)
+	InterpolationHold Interpolation = "hold"
+)
+
+// Kind is the type of the numbers of a stream
+type Kind int
+
+const (
+	// KindFloat numbers are written with as many decimals as they need, and interpolated linearly
+	KindFloat Kind = iota
+	// KindInteger numbers (counters, laps, frame indices...) are written without decimals and held between samples
+	KindInteger
+	// KindBoolean numbers (flags like recording, brake on, GPS lock...) are 0 or 1, written without sign or decimals and held between samples
+	KindBoolean
+)
+
+// Returns the display settings implied by a kind of numbers, unless the display already overrides them
+func kindDisplay(kind Kind, display Display) Display {
+	if kind == KindFloat {
+		return display
+	}
+	if display.DecimalDigits == nil {
+		decimals := 0
+		display.DecimalDigits = &decimals
+	}
+	if kind == KindBoolean {
+		display.Unsigned = true
+		if display.Legal == nil {
+			display.Legal = &Range{0, 1}
+		}
+	}
+	return display
+}
+
+// Makes sure boolean numbers are 0 or 1 (or gaps)
+func checkBooleans(values []float64) error {
+	for _, v := range values {
+		if v != 0 && v != 1 && !math.IsNaN(v) {
+			return fmt.Errorf("%w: booleans must be 0 or 1, found %v", ErrInvalidValue, v)
+		}
+	}
+	return nil
+}
+
+// Range is an interval of numbers, from Min to Max
+type Range struct {
+	Min float64
+	Max float64
+}
+
+// Display overrides how the numbers of a stream are padded and which of them are legal
+// Its zero value keeps the settings computed from the data
+type Display struct {
+	// IntegerDigits is the minimum width of the integer part, e.g. 3 for "000.0", up to 10
+	IntegerDigits int
+	// DecimalDigits fixes the number of decimals, up to 17, and values are rounded to it
+	DecimalDigits *int
+	// Unsigned numbers are written without a sign, and negative values are an error
+	Unsigned bool
+	// Legal replaces the legal range, which otherwise is the occurring one
+	Legal *Range
+}
+
+// Stream contains a slice of values, strings or arrays and their label
+// The slices must be of the same length as the timing slice in their parent's FormattedData, or their own Timing
+// Only one of the slices must be present
+// Arrays are multidimensional values (a 2D position, a 3 axis acceleration...), all with the same number of dimensions
+// EventMarker makes After Effects display Strings as markers (laps, photos, waypoints...) rather than held text
+// Streams sampled at their own rate, or sparse ones like events, can have their own Timing,
+// which replaces the parent's for this stream. The parent's Timing is only needed by streams without one
+// Interpolation overrides the default interpolation of the stream's type
+// NaN marks a missing value (a gap) in Values and Arrays. Options.Gaps decides how they are written
+// Kind sets the type of the numbers of Values and Arrays, floats by default
+// Display overrides the padding and legal range of Values and Arrays
+// ID is the stable matchName and sampleSetID that After Effects uses to link the stream to expressions and properties.
+// By default it is derived from the label (and the labels of its groups), so that adding other streams does not change it
+// Unit is the unit of Values and Arrays (see ConvertStream). The default ID keeps the unit at the end of the label,
+// so converting the stream changes it. Set an explicit ID to keep the links of a project
 type Stream struct {
+	ID            string
+	Label         string
+	Unit          Unit
+	Values        []float64
+	Strings       []string
+	Arrays        [][]float64
+	EventMarker   bool
+	Timing        []time.Time
+	Interpolation Interpolation
+	Kind          Kind
+	Display       Display
+}
+
+// Returns the number of samples in a stream, whichever its type
+func streamLength(st Stream) int {
+	return maxInt(len(st.Values), maxInt(len(st.Strings), len(st.Arrays)))
+}
+
+// Static contains a single value or string that does not change over time and its label
+// Only one of Value or String must be present, not both
+// Kind sets the type of Value, and Display overrides its padding and legal range
+// ID is the stable matchName of the field, derived from the label by default, like the ID of a Stream
+type Static struct {
+	ID      string
+	Label   string
+	Value   *float64
+	String  *string
+	Kind    Kind
+	Display Display
+}
+
+// Group contains streams, static fields and nested groups that are displayed together under its label
+// Its streams use the timing slice of the parent FormattedData, unless they have their own
+type Group struct {
 	Label   string
-	Values  []float64
-	Strings []string
+	Streams []Stream
+	Statics []Static
+	Groups  []Group
 }
 
 // FormattedData is the struct accepted by ToMgjson.
-// It consists of a slice of timestamps and a slice with all the streams of labelled values (floats for now)
+// It consists of a slice of timestamps, a slice with all the streams of labelled values (floats for now),
+// an optional slice of static fields that do not change over time and optional groups to organize them in a tree
 type FormattedData struct {
 	Timing  []time.Time
 	Streams []Stream
+	Statics []Static
+	Groups  []Group
 }
 
 // mgJSON structure. For now, only the fields we are using are specified
@@ -68,8 +201,9 @@ type utcInfo struct {
 }
 
 type dynamicDataInfo struct {
-	UseTimecodeB bool    `json:"useTimecodeB"`
-	UtcInfo      utcInfo `json:"utcInfo"`
+	UseTimecodeB bool          `json:"useTimecodeB"`
+	UtcInfo      utcInfo       `json:"utcInfo"`
+	TimecodeInfo *timecodeInfo `json:"timecodeInfo,omitempty"`
 }
 
 type pattern struct {
@@ -99,21 +233,46 @@ type paddedStringProperties struct {
 	EventMarkerB         bool `json:"eventMarkerB"`
 }
 
+type arrayRanges struct {
+	Ranges []mRange `json:"ranges"`
+}
+
+type numberArrayProperties struct {
+	Pattern     pattern     `json:"pattern"`
+	ArraySize   int         `json:"arraySize"`
+	ArrayRanges arrayRanges `json:"arrayRanges"`
+}
+
 type dataType struct {
 	Type                   string                 `json:"type"`
 	NumberStringProperties numberStringProperties `json:"numberStringProperties"`
 	PaddedStringProperties paddedStringProperties `json:"paddedStringProperties"`
+	NumberArrayProperties  *numberArrayProperties `json:"numberArrayProperties,omitempty"`
 }
 
 type singleDataOutline struct {
-	ObjectType            string   `json:"objectType"`
-	DisplayName           string   `json:"displayName"`
-	SampleSetID           string   `json:"sampleSetID"`
-	DataType              dataType `json:"dataType"`
-	Interpolation         string   `json:"interpolation"`
-	HasExpectedFrequencyB bool     `json:"hasExpectedFrequecyB"`
-	SampleCount           int      `json:"sampleCount"`
-	MatchName             string   `json:"matchName"`
+	ObjectType            string        `json:"objectType"`
+	DisplayName           string        `json:"displayName"`
+	SampleSetID           string        `json:"sampleSetID"`
+	DataType              dataType      `json:"dataType"`
+	Interpolation         Interpolation `json:"interpolation"`
+	HasExpectedFrequencyB bool          `json:"hasExpectedFrequecyB"`
+	SampleCount           int           `json:"sampleCount"`
+	MatchName             string        `json:"matchName"`
+}
+
+type staticDataOutline struct {
+	ObjectType  string      `json:"objectType"`
+	DisplayName string      `json:"displayName"`
+	DataType    dataType    `json:"dataType"`
+	MatchName   string      `json:"matchName"`
+	Value       interface{} `json:"value"`
+}
+
+type groupDataOutline struct {
+	ObjectType  string        `json:"objectType"`
+	DisplayName string        `json:"displayName"`
+	Children    []interface{} `json:"children"`
 }
 
 type paddedStringValue struct {
@@ -136,149 +295,745 @@ type mgjson struct {
 	Creator                string              `json:"creator"`
 	DynamicSamplesPresentB bool                `json:"dynamicSamplesPresentB"`
 	DynamicDataInfo        dynamicDataInfo     `json:"dynamicDataInfo"`
-	DataOutline            []singleDataOutline `json:"dataOutline"`
+	DataOutline            []interface{}       `json:"dataOutline"`
 	DataDynamicSamples     []dataDynamicSample `json:"dataDynamicSamples"`
 }
 
-// ToMgjson receives a formatted source data (FormattedData) and a creator or author name
-// and returns formatted mgjson ready to write to a file
-// compatible with Adobe After Effects data-driven animations (or an error)
-func ToMgjson(sd FormattedData, creator string) ([]byte, error) {
+// Returns the pattern and range that fit all values, following the display overrides
+func numberPattern(values []float64, display Display) (pattern, mRange, error) {
+	min := largestMgjsonNum
+	max := -largestMgjsonNum
+	p := pattern{
+		DigitsInteger: display.IntegerDigits,
+		IsSigned:      !display.Unsigned,
+	}
 
-	if len(sd.Streams) < 1 {
-		return nil, fmt.Errorf("No streams found")
+	if display.IntegerDigits < 0 || display.IntegerDigits > maxIntegerDigits {
+		return p, mRange{}, fmt.Errorf("%w: %d integer digits, not between 0 and %d", ErrInvalidDisplay, display.IntegerDigits, maxIntegerDigits)
 	}
 
-	if len(sd.Timing) < 1 {
-		return nil, fmt.Errorf("No timing data")
+	decimals := -1
+	if display.DecimalDigits != nil {
+		if *display.DecimalDigits < 0 || *display.DecimalDigits > maxDecimalDigits {
+			return p, mRange{}, fmt.Errorf("%w: %d decimal digits, not between 0 and %d", ErrInvalidDisplay, *display.DecimalDigits, maxDecimalDigits)
+		}
+		decimals = *display.DecimalDigits
 	}
 
-	//Hardcode non configurable values (for now)
-	data := mgjson{
-		Version:                "MGJSON2.0.0",
-		Creator:                creator,
-		DynamicSamplesPresentB: true,
-		DynamicDataInfo: dynamicDataInfo{
-			UseTimecodeB: false,
-			UtcInfo: utcInfo{
-				PrecisionLength: 3,
-				IsGMT:           true,
-			},
+	for _, v := range values {
+		v = validValue(v)
+		if display.Unsigned && v < 0 {
+			return p, mRange{}, fmt.Errorf("%w: %v is negative but unsigned", ErrInvalidValue, v)
+		}
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+		integer, decimal := sides(v, decimals)
+		p.DigitsInteger = maxInt(p.DigitsInteger, len(integer))
+		p.DigitsDecimal = maxInt(p.DigitsDecimal, len(decimal))
+	}
+
+	r := mRange{
+		Occuring: minmax{min, max},
+		Legal:    minmax{min, max},
+	}
+
+	if display.Legal != nil {
+		if display.Legal.Min > display.Legal.Max {
+			return p, r, fmt.Errorf("%w: legal range minimum is greater than its maximum", ErrInvalidDisplay)
+		}
+		r.Legal = minmax{display.Legal.Min, display.Legal.Max}
+	}
+
+	return p, r, nil
+}
+
+// Returns the numberString data type that fits all values, and its pattern
+func numberDataType(values []float64, display Display) (dataType, pattern, error) {
+	p, r, err := numberPattern(values, display)
+	if err != nil {
+		return dataType{}, p, err
+	}
+
+	return dataType{
+		Type: "numberString",
+		NumberStringProperties: numberStringProperties{
+			Pattern: p,
+			Range:   r,
 		},
-		DataOutline:        []singleDataOutline{},
-		DataDynamicSamples: []dataDynamicSample{},
+	}, p, nil
+}
+
+// Formats a number as a padded string following its numberString pattern
+func paddedNumber(v float64, p pattern) string {
+	width := p.DigitsInteger
+	if p.DigitsDecimal > 0 {
+		// Decimal point and decimals
+		width += p.DigitsDecimal + 1
 	}
+	format := "%0*.*f"
+	if p.IsSigned {
+		format = "%+0*.*f"
+		width++
+	}
+	return fmt.Sprintf(format, width, p.DigitsDecimal, validValue(v))
+}
 
-	for i, stream := range sd.Streams {
-		sName := fmt.Sprintf("Stream%d", i)
-		min := largestMgjsonNum
-		max := -largestMgjsonNum
-		digitsInteger := 0
-		digitsDecimal := 0
-		maxLen := 0
-		maxDigitsInStrLength := 0
+// Returns the numberStringArray data type that fits all arrays, and its pattern
+// The pattern is shared by all dimensions, but each of them gets its own range
+func arrayDataType(arrays [][]float64, display Display) (dataType, pattern, error) {
+	size := len(arrays[0])
+	ranges := []mRange{}
+	p := pattern{IsSigned: !display.Unsigned}
 
-		for _, v := range stream.Values {
-			v = validValue(v)
-			min = math.Min(min, v)
-			max = math.Max(max, v)
-			integer, decimal := sides(v)
-			digitsInteger = maxInt(digitsInteger, len(integer))
-			digitsDecimal = maxInt(digitsDecimal, len(decimal))
+	for d := 0; d < size; d++ {
+		dimension := make([]float64, len(arrays))
+		for i, a := range arrays {
+			dimension[i] = a[d]
 		}
+		dimensionPattern, dimensionRange, err := numberPattern(dimension, display)
+		if err != nil {
+			return dataType{}, p, err
+		}
+		ranges = append(ranges, dimensionRange)
+		p.DigitsInteger = maxInt(p.DigitsInteger, dimensionPattern.DigitsInteger)
+		p.DigitsDecimal = maxInt(p.DigitsDecimal, dimensionPattern.DigitsDecimal)
+	}
+
+	return dataType{
+		Type: "numberStringArray",
+		NumberArrayProperties: &numberArrayProperties{
+			Pattern:     p,
+			ArraySize:   size,
+			ArrayRanges: arrayRanges{ranges},
+		},
+	}, p, nil
+}
+
+// Formats every dimension of an array as a padded string following its pattern
+func paddedArray(a []float64, p pattern) []string {
+	padded := make([]string, len(a))
+	for i, v := range a {
+		padded[i] = paddedNumber(v, p)
+	}
+	return padded
+}
 
-		for _, v := range stream.Strings {
-			maxLen = maxInt(maxLen, len(v))
-			maxDigitsInStrLength = len(strconv.Itoa(maxLen))
+// Returns the length of a string in UTF-16 code units, as the JavaScript of After Effects counts it
+// Most characters count as one, and those outside the Basic Multilingual Plane (most emoji) as two
+func stringLength(s string) int {
+	length := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			length += 2
+		} else {
+			length++
 		}
+	}
+	return length
+}
 
-		var thisDataType dataType
-		var thisInterpolation string
-		var thisSampleCount int
+// Returns the first n UTF-16 code units of a string, or false if they are out of range or split a character
+func stringPrefix(s string, n int) (string, bool) {
+	length := 0
+	for i, r := range s {
+		if length == n {
+			return s[:i], true
+		}
+		if r >= 0x10000 {
+			length += 2
+		} else {
+			length++
+		}
+		if length > n {
+			return "", false
+		}
+	}
+	return s, length == n
+}
 
-		if len(stream.Values) > 0 {
+// Returns the strings in Unicode Normalization Form C, so that characters like "é" have the same length
+// whether they were composed ("\u00e9") or decomposed ("e\u0301") in the source
+func normalizeStrings(xs []string) []string {
+	normalized := make([]string, len(xs))
+	for i, s := range xs {
+		normalized[i] = norm.NFC.String(s)
+	}
+	return normalized
+}
+
+// Returns the paddedString data type that fits all strings, and its max length and length digits
+// Lengths are in UTF-16 code units (see stringLength)
+func stringDataType(strings []string, eventMarker bool) (dataType, int, int) {
+	maxLen := 0
+	maxDigitsInStrLength := 0
+
+	for _, v := range strings {
+		maxLen = maxInt(maxLen, stringLength(v))
+		maxDigitsInStrLength = len(strconv.Itoa(maxLen))
+	}
+
+	return dataType{
+		Type: "paddedString",
+		PaddedStringProperties: paddedStringProperties{
+			MaxLen:               maxLen,
+			MaxDigitsInStrLength: maxDigitsInStrLength,
+			EventMarkerB:         eventMarker,
+		},
+	}, maxLen, maxDigitsInStrLength
+}
+
+// Pads a string to the max length of its paddedString data type
+func paddedString(v string, maxLen, maxDigitsInStrLength int) paddedStringValue {
+	return paddedStringValue{
+		Length: fmt.Sprintf("%0*d", maxDigitsInStrLength, stringLength(v)),
+		Str:    v + strings.Repeat(" ", maxLen-stringLength(v)),
+	}
+}
+
+// Returns the outline of a static field, which includes its value
+func staticOutline(static Static, sName string) (staticDataOutline, error) {
+	outline := staticDataOutline{
+		ObjectType:  "dataStatic",
+		DisplayName: static.Label,
+		MatchName:   sName,
+	}
 
-			thisDataType = dataType{
-				Type: "numberString",
-				NumberStringProperties: numberStringProperties{
-					Pattern: pattern{
-						DigitsInteger: digitsInteger,
-						DigitsDecimal: digitsDecimal,
-						IsSigned:      true,
-					},
-					Range: mRange{
-						Occuring: minmax{min, max},
-						Legal:    minmax{min, max},
-					},
-				},
+	if static.Value != nil && static.String != nil {
+		return outline, fmt.Errorf("%w: it has both a value and a string", ErrInvalidStatic)
+	}
+
+	if static.Value != nil {
+		if static.Kind == KindBoolean {
+			err := checkBooleans([]float64{*static.Value})
+			if err != nil {
+				return outline, err
 			}
-			thisInterpolation = "linear"
-			thisSampleCount = len(stream.Values)
+		}
+		thisDataType, thisPattern, err := numberDataType([]float64{*static.Value}, kindDisplay(static.Kind, static.Display))
+		if err != nil {
+			return outline, err
+		}
+		outline.DataType = thisDataType
+		outline.Value = paddedNumber(*static.Value, thisPattern)
+	} else if static.String != nil {
+		value := norm.NFC.String(*static.String)
+		thisDataType, maxLen, maxDigitsInStrLength := stringDataType([]string{value}, false)
+		outline.DataType = thisDataType
+		outline.Value = paddedString(value, maxLen, maxDigitsInStrLength)
+	} else {
+		return outline, fmt.Errorf("%w: it has no value", ErrInvalidStatic)
+	}
 
-		} else if len(stream.Strings) > 0 {
+	return outline, nil
+}
+
+// A dynamic stream and the settings needed to format its samples
+type sampleSet struct {
+	id                   string
+	stream               Stream
+	timing               []time.Time
+	pattern              pattern
+	maxLen               int
+	maxDigitsInStrLength int
+}
+
+// Keeps track of the sample sets while walking the groups of a FormattedData
+type outlineBuilder struct {
+	timing     []time.Time
+	formatTime func(time.Time) string
+	// Timecodes wrap at midnight, so formatted times can go backwards
+	timecode   bool
+	gaps       GapPolicy
+	collisions CollisionPolicy
+	streams    int
+	statics    int
+	sets       []sampleSet
+	// IDs set explicitly anywhere in the tree, and IDs already given
+	reserved  map[string]bool
+	ids       map[string]bool
+	legacyIDs bool
+}
+
+// Returns the default ID of a label: its letters and digits, in any script, joined by underscores
+// The label is normalized first, so that "é" typed as one or two code points gives the same ID
+func labelID(label string) string {
+	words := strings.FieldsFunc(norm.NFC.String(label), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "_")
+}
+
+// Reserves the explicit IDs of the tree, so that default IDs never take them
+func (b *outlineBuilder) reserve(streams []Stream, statics []Static, groups []Group) {
+	if b.reserved == nil {
+		b.reserved = map[string]bool{}
+		b.ids = map[string]bool{}
+	}
+	for _, stream := range streams {
+		if stream.ID != "" {
+			b.reserved[stream.ID] = true
+		}
+	}
+	for _, static := range statics {
+		if static.ID != "" {
+			b.reserved[static.ID] = true
+		}
+	}
+	for _, group := range groups {
+		b.reserve(group.Streams, group.Statics, group.Groups)
+	}
+}
 
-			thisDataType = dataType{
-				Type: "paddedString",
-				PaddedStringProperties: paddedStringProperties{
-					MaxLen:               maxLen,
-					MaxDigitsInStrLength: maxDigitsInStrLength,
-					EventMarkerB:         false,
-				},
+// Returns the explicit ID of a stream or static field, or a unique one derived from its label
+// Repeated labels get a numeric suffix ("speed", "speed_2"...)
+// With legacy IDs, the default is the fallback and the position n in the whole tree ("Stream0", "Static2"...)
+func (b *outlineBuilder) id(explicit, prefix, label, fallback string, n int) (string, error) {
+	if explicit != "" {
+		if b.ids[explicit] {
+			return "", fmt.Errorf("%w: %q", ErrDuplicateID, explicit)
+		}
+		b.ids[explicit] = true
+		return explicit, nil
+	}
+	base := labelID(label)
+	if base == "" {
+		base = fallback
+	}
+	if prefix != "" {
+		base = prefix + "_" + base
+	}
+	if b.legacyIDs {
+		base = fmt.Sprintf("%s%d", fallback, n)
+	}
+	id := base
+	for n := 2; b.ids[id] || b.reserved[id]; n++ {
+		id = fmt.Sprintf("%s_%d", base, n)
+	}
+	b.ids[id] = true
+	return id, nil
+}
+
+// Returns whether a sample of a stream is missing, in full or in any of its dimensions
+func isGap(stream Stream, i int) bool {
+	if len(stream.Values) > 0 {
+		return math.IsNaN(stream.Values[i])
+	}
+	if len(stream.Arrays) > 0 {
+		for _, v := range stream.Arrays[i] {
+			if math.IsNaN(v) {
+				return true
 			}
-			thisInterpolation = "hold"
-			thisSampleCount = len(stream.Strings)
+		}
+	}
+	return false
+}
+
+// Fills the gaps of a slice of values with the last known value, or interpolating linearly by time
+// Values before the first known one take its value, and a slice without known values is filled with zeros
+func fillValues(values []float64, timing []time.Time, interpolate bool) []float64 {
+	filled := make([]float64, len(values))
+	copy(filled, values)
 
+	previous := -1
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
 		}
+		for j := previous + 1; j < i; j++ {
+			if previous < 0 {
+				filled[j] = v
+			} else if duration := timing[i].Sub(timing[previous]); interpolate && duration > 0 {
+				ratio := float64(timing[j].Sub(timing[previous])) / float64(duration)
+				filled[j] = values[previous] + (v-values[previous])*ratio
+			} else {
+				filled[j] = values[previous]
+			}
+		}
+		previous = i
+	}
 
-		if len(sd.Timing) != thisSampleCount {
-			return nil, fmt.Errorf("Timing data does not match slice length")
+	for j := previous + 1; j < len(values); j++ {
+		if previous < 0 {
+			filled[j] = 0
+		} else {
+			filled[j] = values[previous]
 		}
+	}
 
-		data.DataOutline = append(data.DataOutline, singleDataOutline{
-			ObjectType:            "dataDynamic",
-			DisplayName:           stream.Label,
-			SampleSetID:           sName,
-			DataType:              thisDataType,
-			Interpolation:         thisInterpolation,
-			HasExpectedFrequencyB: false,
-			SampleCount:           thisSampleCount,
-			MatchName:             sName,
-		})
+	return filled
+}
+
+// Handles the gaps of a stream according to the gap policy
+// Omitting all samples of a stream would leave it without a data type, so that is an error
+func (b *outlineBuilder) fillGaps(stream Stream, timing []time.Time) (Stream, []time.Time, error) {
+	found := false
+	for i := 0; i < len(timing) && !found; i++ {
+		found = isGap(stream, i)
+	}
 
-		streamSamples := []sample{}
+	if !found || b.gaps == GapZero {
+		return stream, timing, nil
+	}
+
+	filled := stream
 
-		for i, v := range stream.Values {
-			v = validValue(v)
-			paddedValue := fmt.Sprintf("%+0*.*f", digitsInteger+digitsDecimal+2, digitsDecimal, v)
-			timeStr := sd.Timing[i].Format("2006-01-02T15:04:05.000Z")
-			streamSamples = append(streamSamples, sample{
-				Time:  timeStr,
-				Value: paddedValue,
-			})
+	if b.gaps == GapOmit {
+		filled.Values = nil
+		filled.Arrays = nil
+		filledTiming := []time.Time{}
+		for i, t := range timing {
+			if isGap(stream, i) {
+				continue
+			}
+			filledTiming = append(filledTiming, t)
+			if len(stream.Values) > 0 {
+				filled.Values = append(filled.Values, stream.Values[i])
+			} else {
+				filled.Arrays = append(filled.Arrays, stream.Arrays[i])
+			}
 		}
+		if len(filledTiming) < 1 {
+			return filled, filledTiming, fmt.Errorf("%w: all samples are gaps", ErrNoData)
+		}
+		return filled, filledTiming, nil
+	}
 
-		for i, v := range stream.Strings {
-			stringValue := paddedStringValue{
-				Length: fmt.Sprintf("%0*d", maxDigitsInStrLength, len(v)),
-				Str:    fmt.Sprintf("%-*v", maxLen, v),
+	interpolate := b.gaps == GapInterpolate
+
+	if len(stream.Values) > 0 {
+		filled.Values = fillValues(stream.Values, timing, interpolate)
+	} else {
+		filled.Arrays = make([][]float64, len(stream.Arrays))
+		for i := range filled.Arrays {
+			filled.Arrays[i] = make([]float64, len(stream.Arrays[i]))
+		}
+		for d := range stream.Arrays[0] {
+			dimension := make([]float64, len(stream.Arrays))
+			for i, a := range stream.Arrays {
+				dimension[i] = a[d]
 			}
-			timeStr := sd.Timing[i].Format("2006-01-02T15:04:05.000Z")
-			streamSamples = append(streamSamples, sample{
-				Time:  timeStr,
-				Value: stringValue,
-			})
+			for i, v := range fillValues(dimension, timing, interpolate) {
+				filled.Arrays[i][d] = v
+			}
+		}
+	}
+
+	return filled, timing, nil
+}
+
+// Drops the samples that get the same time as a neighbour once formatted, according to the collision policy
+// Timecodes that go backwards, past midnight, are an error
+func (b *outlineBuilder) resolveCollisions(stream Stream, timing []time.Time) (Stream, []time.Time, error) {
+	collides := func(i, j int) bool {
+		return j >= 0 && j < len(timing) && b.formatTime(timing[i]) == b.formatTime(timing[j])
+	}
+
+	found := false
+	for i := 1; i < len(timing); i++ {
+		if prev, this := b.formatTime(timing[i-1]), b.formatTime(timing[i]); b.timecode && this < prev {
+			return stream, timing, fmt.Errorf("%w: timecode goes back from %v to %v at samples %d and %d, times must be within a day", ErrInvalidOption, prev, this, i-1, i)
+		}
+		if collides(i, i-1) {
+			if b.collisions == CollisionError {
+				return stream, timing, fmt.Errorf("%w: samples %d and %d at %v", ErrTimeCollision, i-1, i, b.formatTime(timing[i]))
+			}
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return stream, timing, nil
+	}
+
+	filtered := stream
+	filtered.Values = nil
+	filtered.Strings = nil
+	filtered.Arrays = nil
+	filteredTiming := []time.Time{}
+
+	for i, t := range timing {
+		if b.collisions == CollisionKeepFirst && collides(i, i-1) {
+			continue
+		}
+		if b.collisions == CollisionKeepLast && collides(i, i+1) {
+			continue
+		}
+		filteredTiming = append(filteredTiming, t)
+		if len(stream.Values) > 0 {
+			filtered.Values = append(filtered.Values, stream.Values[i])
+		} else if len(stream.Strings) > 0 {
+			filtered.Strings = append(filtered.Strings, stream.Strings[i])
+		} else {
+			filtered.Arrays = append(filtered.Arrays, stream.Arrays[i])
+		}
+	}
+
+	return filtered, filteredTiming, nil
+}
+
+// Returns the outline of a dynamic stream and adds its sample set to the builder
+func (b *outlineBuilder) streamOutline(stream Stream, prefix string) (singleDataOutline, error) {
+	sName, err := b.id(stream.ID, prefix, stream.Label, "Stream", b.streams)
+	if err != nil {
+		return singleDataOutline{}, err
+	}
+	b.streams++
+
+	timing := b.timing
+	if stream.Timing != nil {
+		timing = stream.Timing
+	}
+
+	if len(timing) < 1 {
+		return singleDataOutline{}, ErrNoTiming
+	}
+
+	if stream.EventMarker && len(stream.Strings) < 1 {
+		return singleDataOutline{}, fmt.Errorf("%w: event markers must be strings", ErrInvalidStream)
+	}
+
+	slices := 0
+	for _, n := range []int{len(stream.Values), len(stream.Strings), len(stream.Arrays)} {
+		if n > 0 {
+			slices++
+		}
+	}
+	if slices > 1 {
+		return singleDataOutline{}, fmt.Errorf("%w: only one of Values, Strings and Arrays can be set", ErrInvalidStream)
+	}
+
+	if len(timing) != streamLength(stream) {
+		return singleDataOutline{}, ErrTimingLength
+	}
+
+	for _, a := range stream.Arrays {
+		if len(a) < 1 || len(a) != len(stream.Arrays[0]) {
+			return singleDataOutline{}, fmt.Errorf("%w: arrays of different dimensions", ErrInvalidStream)
+		}
+	}
+
+	if stream.Kind == KindBoolean {
+		err := checkBooleans(stream.Values)
+		for i := 0; i < len(stream.Arrays) && err == nil; i++ {
+			err = checkBooleans(stream.Arrays[i])
+		}
+		if err != nil {
+			return singleDataOutline{}, err
+		}
+	}
+
+	stream, timing, err = b.fillGaps(stream, timing)
+	if err != nil {
+		return singleDataOutline{}, err
+	}
+
+	stream, timing, err = b.resolveCollisions(stream, timing)
+	if err != nil {
+		return singleDataOutline{}, err
+	}
+
+	var thisDataType dataType
+	var thisInterpolation Interpolation
+	var thisSampleCount int
+	var thisPattern pattern
+	var maxLen, maxDigitsInStrLength int
+
+	if len(stream.Values) > 0 {
+
+		thisDataType, thisPattern, err = numberDataType(stream.Values, kindDisplay(stream.Kind, stream.Display))
+		if err != nil {
+			return singleDataOutline{}, err
 		}
+		thisInterpolation = InterpolationLinear
+		thisSampleCount = len(stream.Values)
+
+	} else if len(stream.Strings) > 0 {
+
+		stream.Strings = normalizeStrings(stream.Strings)
+		thisDataType, maxLen, maxDigitsInStrLength = stringDataType(stream.Strings, stream.EventMarker)
+		thisInterpolation = InterpolationHold
+		thisSampleCount = len(stream.Strings)
 
-		data.DataDynamicSamples = append(data.DataDynamicSamples, dataDynamicSample{
-			SampleSetID: sName,
-			Samples:     streamSamples,
+	} else if len(stream.Arrays) > 0 {
+
+		thisDataType, thisPattern, err = arrayDataType(stream.Arrays, kindDisplay(stream.Kind, stream.Display))
+		if err != nil {
+			return singleDataOutline{}, err
+		}
+		thisInterpolation = InterpolationLinear
+		thisSampleCount = len(stream.Arrays)
+
+	}
+
+	if stream.Kind != KindFloat {
+		thisInterpolation = InterpolationHold
+	}
+
+	switch stream.Interpolation {
+	case InterpolationDefault:
+	case InterpolationHold:
+		thisInterpolation = stream.Interpolation
+	case InterpolationLinear:
+		if len(stream.Strings) > 0 {
+			return singleDataOutline{}, fmt.Errorf("%w: strings can only use hold interpolation", ErrInvalidStream)
+		}
+		thisInterpolation = stream.Interpolation
+	default:
+		return singleDataOutline{}, fmt.Errorf("%w: unknown interpolation %q", ErrInvalidStream, stream.Interpolation)
+	}
+
+	b.sets = append(b.sets, sampleSet{
+		id:                   sName,
+		stream:               stream,
+		timing:               timing,
+		pattern:              thisPattern,
+		maxLen:               maxLen,
+		maxDigitsInStrLength: maxDigitsInStrLength,
+	})
+
+	return singleDataOutline{
+		ObjectType:            "dataDynamic",
+		DisplayName:           stream.Label,
+		SampleSetID:           sName,
+		DataType:              thisDataType,
+		Interpolation:         thisInterpolation,
+		HasExpectedFrequencyB: false,
+		SampleCount:           thisSampleCount,
+		MatchName:             sName,
+	}, nil
+}
+
+// Returns the outline entries of one level of the tree: streams, then static fields, then nested groups
+// The prefix is made of the labels of the parent groups, to tell apart the default IDs of streams with the same label
+func (b *outlineBuilder) outline(prefix string, streams []Stream, statics []Static, groups []Group) ([]interface{}, error) {
+	outline := []interface{}{}
+
+	for _, stream := range streams {
+		streamOutline, err := b.streamOutline(stream, prefix)
+		if err != nil {
+			return nil, &StreamError{Label: stream.Label, Err: err}
+		}
+		outline = append(outline, streamOutline)
+	}
+
+	for _, static := range statics {
+		sName, err := b.id(static.ID, prefix, static.Label, "Static", b.statics)
+		if err != nil {
+			return nil, &StreamError{Label: static.Label, Err: err}
+		}
+		staticOutline, err := staticOutline(static, sName)
+		if err != nil {
+			return nil, &StreamError{Label: static.Label, Err: err}
+		}
+		b.statics++
+		outline = append(outline, staticOutline)
+	}
+
+	for _, group := range groups {
+		groupPrefix := labelID(group.Label)
+		if groupPrefix == "" {
+			groupPrefix = "Group"
+		}
+		if prefix != "" {
+			groupPrefix = prefix + "_" + groupPrefix
+		}
+		children, err := b.outline(groupPrefix, group.Streams, group.Statics, group.Groups)
+		if err != nil {
+			return nil, err
+		}
+		outline = append(outline, groupDataOutline{
+			ObjectType:  "dataGroup",
+			DisplayName: group.Label,
+			Children:    children,
 		})
 	}
 
-	doc, err := json.Marshal(data)
+	return outline, nil
+}
+
+// Options contains the document-level settings of ToMgjsonWithOptions and Encoder
+// Their zero values produce the same output as ToMgjson
+type Options struct {
+	// Creator or author name
+	Creator string
+	// Version of the mgJSON format, "MGJSON2.0.0" by default
+	Version string
+	// PrecisionLength is the number of decimals of a second in sample times (1 to 9), 3 by default, 6 for microseconds
+	PrecisionLength int
+	// Indent makes the output human readable, indenting it with this string (e.g. "\t")
+	Indent string
+	// Timecode keys samples by SMPTE timecode instead of UTC dates
+	Timecode *Timecode
+	// Gaps decides how missing values (NaN) are written
+	Gaps GapPolicy
+	// Collisions decides what to do with samples of a stream that get the same time once formatted
+	Collisions CollisionPolicy
+	// Location writes sample times in a local time zone, with their offset, instead of GMT
+	// It also sets the time of day used by Timecode
+	Location *time.Location
+	// KeepOffset writes each sample time with the offset of its own time.Time, like the "+09:00" read
+	// from the timestamps of a GPX or CSV file, instead of GMT. Location takes precedence over it
+	KeepOffset bool
+	// LegacyIDs gives streams and static fields without an ID the position-based IDs of earlier versions
+	// ("Stream0", "Stream1"... and "Static0"...), to keep projects made with them linked
+	LegacyIDs bool
+}
+
+// GapPolicy decides how missing values (NaN) of streams are written
+type GapPolicy int
+
+const (
+	// GapZero writes missing values as zeros
+	GapZero GapPolicy = iota
+	// GapOmit leaves the sample out of the stream. A stream with only gaps is an error
+	GapOmit
+	// GapHold repeats the last known value
+	GapHold
+	// GapInterpolate computes the value linearly from the known values around it, by time
+	GapInterpolate
+)
+
+// CollisionPolicy decides what to do with samples of a stream that get the same time
+// once rounded to the precision length (or to a frame of Timecode), as After Effects does not accept duplicate times
+type CollisionPolicy int
+
+const (
+	// CollisionKeepFirst keeps the first sample of those with the same time
+	CollisionKeepFirst CollisionPolicy = iota
+	// CollisionKeepLast keeps the last sample of those with the same time
+	CollisionKeepLast
+	// CollisionError makes the conversion fail, with the index of the samples
+	CollisionError
+)
+
+const defaultMgjsonVersion = "MGJSON2.0.0"
+const defaultPrecisionLength = 3
+
+// ToMgjson receives a formatted source data (FormattedData) and a creator or author name
+// and returns formatted mgjson ready to write to a file
+// compatible with Adobe After Effects data-driven animations (or an error)
+func ToMgjson(sd FormattedData, creator string) ([]byte, error) {
+	return ToMgjsonWithOptions(sd, Options{Creator: creator})
+}
+
+// ToMgjsonWithOptions works like ToMgjson, with the document-level settings and output formatting of Options
+func ToMgjsonWithOptions(sd FormattedData, opts Options) ([]byte, error) {
+	var doc bytes.Buffer
+
+	err := NewEncoder(&doc, opts).Encode(sd)
 	if err != nil {
 		return nil, err
 	}
 
-	return doc, nil
+	if opts.Indent != "" {
+		var indented bytes.Buffer
+		err = json.Indent(&indented, doc.Bytes(), "", opts.Indent)
+		if err != nil {
+			return nil, err
+		}
+		return indented.Bytes(), nil
+	}
+
+	return doc.Bytes(), nil
 }
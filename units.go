@@ -0,0 +1,225 @@
+package tomgjson
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Unit is the symbol of the unit of the values of a stream, like "m/s"
+type Unit string
+
+// Supported units. Streams can use other units, but they can not be converted
+const (
+	UnitMeter                 Unit = "m"
+	UnitKilometer             Unit = "km"
+	UnitFoot                  Unit = "ft"
+	UnitMile                  Unit = "mi"
+	UnitNauticalMile          Unit = "nmi"
+	UnitMeterPerSecond        Unit = "m/s"
+	UnitKilometerPerHour      Unit = "km/h"
+	UnitFootPerSecond         Unit = "ft/s"
+	UnitMilePerHour           Unit = "mph"
+	UnitKnot                  Unit = "kn"
+	UnitMinutePerKilometer    Unit = "min/km"
+	UnitMinutePerMile         Unit = "min/mi"
+	UnitMeterPerSecondSquared Unit = "m/s²"
+	UnitStandardGravity       Unit = "g"
+	UnitCelsius               Unit = "°C"
+	UnitFahrenheit            Unit = "°F"
+	UnitKelvin                Unit = "K"
+	UnitDegree                Unit = "°"
+	UnitRadian                Unit = "rad"
+	UnitSecond                Unit = "s"
+	UnitMinute                Unit = "min"
+	UnitHour                  Unit = "h"
+)
+
+// How to convert a unit to the base unit of its quantity: base = value * scale + offset
+// Paces are inverse speeds: base = scale / value
+type unitDefinition struct {
+	quantity string
+	scale    float64
+	offset   float64
+	inverse  bool
+}
+
+var units = map[Unit]unitDefinition{
+	UnitMeter:                 {quantity: "length", scale: 1},
+	UnitKilometer:             {quantity: "length", scale: 1000},
+	UnitFoot:                  {quantity: "length", scale: 0.3048},
+	UnitMile:                  {quantity: "length", scale: 1609.344},
+	UnitNauticalMile:          {quantity: "length", scale: 1852},
+	UnitMeterPerSecond:        {quantity: "speed", scale: 1},
+	UnitKilometerPerHour:      {quantity: "speed", scale: 1000.0 / 3600},
+	UnitFootPerSecond:         {quantity: "speed", scale: 0.3048},
+	UnitMilePerHour:           {quantity: "speed", scale: 1609.344 / 3600},
+	UnitKnot:                  {quantity: "speed", scale: 1852.0 / 3600},
+	UnitMinutePerKilometer:    {quantity: "speed", scale: 1000.0 / 60, inverse: true},
+	UnitMinutePerMile:         {quantity: "speed", scale: 1609.344 / 60, inverse: true},
+	UnitMeterPerSecondSquared: {quantity: "acceleration", scale: 1},
+	UnitStandardGravity:       {quantity: "acceleration", scale: 9.80665},
+	UnitCelsius:               {quantity: "temperature", scale: 1},
+	UnitFahrenheit:            {quantity: "temperature", scale: 5.0 / 9, offset: -32 * 5.0 / 9},
+	UnitKelvin:                {quantity: "temperature", scale: 1, offset: -273.15},
+	UnitDegree:                {quantity: "angle", scale: 1},
+	UnitRadian:                {quantity: "angle", scale: 180 / math.Pi},
+	UnitSecond:                {quantity: "time", scale: 1},
+	UnitMinute:                {quantity: "time", scale: 60},
+	UnitHour:                  {quantity: "time", scale: 3600},
+}
+
+// A pace of zero speed is infinite, so it is kept as a gap
+func (u unitDefinition) toBase(v float64) float64 {
+	if u.inverse {
+		if v == 0 {
+			return math.NaN()
+		}
+		return u.scale / v
+	}
+	return v*u.scale + u.offset
+}
+
+func (u unitDefinition) fromBase(v float64) float64 {
+	if u.inverse {
+		if v == 0 {
+			return math.NaN()
+		}
+		return u.scale / v
+	}
+	return (v - u.offset) / u.scale
+}
+
+// Returns a function that converts values between two units of the same quantity
+func converter(from, to Unit) (func(float64) float64, error) {
+	fromDefinition, ok := units[from]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownUnit, from)
+	}
+	toDefinition, ok := units[to]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownUnit, to)
+	}
+	if fromDefinition.quantity != toDefinition.quantity {
+		return nil, fmt.Errorf("%w: can not convert %s (%q) to %s (%q)", ErrIncompatibleUnits, fromDefinition.quantity, from, toDefinition.quantity, to)
+	}
+	return func(v float64) float64 {
+		if from == to {
+			return v
+		}
+		return toDefinition.fromBase(fromDefinition.toBase(v))
+	}, nil
+}
+
+// ConvertValue converts a number from one unit to another of the same quantity (length, speed, temperature...)
+func ConvertValue(v float64, from, to Unit) (float64, error) {
+	convert, err := converter(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return convert(v), nil
+}
+
+// Labels like "speed (m/s)" end with their unit
+var unitSuffix = regexp.MustCompile(`^(.*) \(([^()]+)\)$`)
+
+// Returns the unit at the end of a label, if it is a supported one
+func labelUnit(label string) Unit {
+	match := unitSuffix.FindStringSubmatch(label)
+	if match == nil {
+		return ""
+	}
+	if _, ok := units[Unit(match[2])]; !ok {
+		return ""
+	}
+	return Unit(match[2])
+}
+
+// Returns the label without the unit at its end
+func trimUnit(label string, unit Unit) string {
+	if unit == "" {
+		return label
+	}
+	return strings.TrimSuffix(label, " ("+string(unit)+")")
+}
+
+// ConvertStream returns a copy of a stream with its Values, Arrays and legal range converted to another unit
+// The unit at the end of its label is replaced (or added), like "speed (m/s)" to "speed (km/h)"
+// The stream's Unit must be set. Gaps are kept, and paces of zero speed become gaps
+func ConvertStream(st Stream, to Unit) (Stream, error) {
+	if st.Unit == "" {
+		return st, &StreamError{Label: st.Label, Err: fmt.Errorf("%w: the stream has no unit", ErrUnknownUnit)}
+	}
+	if len(st.Strings) > 0 {
+		return st, &StreamError{Label: st.Label, Err: fmt.Errorf("%w: strings can not be converted", ErrIncompatibleUnits)}
+	}
+	convert, err := converter(st.Unit, to)
+	if err != nil {
+		return st, &StreamError{Label: st.Label, Err: err}
+	}
+
+	converted := st
+	converted.Label = trimUnit(st.Label, st.Unit) + " (" + string(to) + ")"
+	converted.Unit = to
+
+	if st.Values != nil {
+		converted.Values = make([]float64, len(st.Values))
+		for i, v := range st.Values {
+			converted.Values[i] = convert(v)
+		}
+	}
+	if st.Arrays != nil {
+		converted.Arrays = make([][]float64, len(st.Arrays))
+		for i, a := range st.Arrays {
+			converted.Arrays[i] = make([]float64, len(a))
+			for d, v := range a {
+				converted.Arrays[i][d] = convert(v)
+			}
+		}
+	}
+	if st.Display.Legal != nil {
+		min, max := convert(st.Display.Legal.Min), convert(st.Display.Legal.Max)
+		converted.Display.Legal = &Range{math.Min(min, max), math.Max(min, max)}
+	}
+
+	return converted, nil
+}
+
+// ConvertUnits returns a copy of the data with the streams of some units converted to others,
+// including the streams of groups. For example, {UnitMeterPerSecond: UnitMilePerHour, UnitMeter: UnitFoot}
+// Streams without a unit, with a unit that is not in the map, or with strings, are kept as they are
+func ConvertUnits(sd FormattedData, conversions map[Unit]Unit) (FormattedData, error) {
+	var err error
+	converted := sd
+	converted.Streams, converted.Groups, err = convertStreams(sd.Streams, sd.Groups, conversions)
+	return converted, err
+}
+
+func convertStreams(streams []Stream, groups []Group, conversions map[Unit]Unit) ([]Stream, []Group, error) {
+	convertedStreams := make([]Stream, len(streams))
+	for i, st := range streams {
+		to, ok := conversions[st.Unit]
+		if st.Unit == "" || !ok || len(st.Strings) > 0 {
+			convertedStreams[i] = st
+			continue
+		}
+		convertedStream, err := ConvertStream(st, to)
+		if err != nil {
+			return nil, nil, err
+		}
+		convertedStreams[i] = convertedStream
+	}
+
+	convertedGroups := make([]Group, len(groups))
+	for i, group := range groups {
+		convertedGroups[i] = group
+		var err error
+		convertedGroups[i].Streams, convertedGroups[i].Groups, err = convertStreams(group.Streams, group.Groups, conversions)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return convertedStreams, convertedGroups, nil
+}
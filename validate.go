@@ -0,0 +1,325 @@
+package tomgjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Problem is a rule of the mgJSON format broken by a document
+// Path locates the offending value, e.g. "$.dataDynamicSamples[0].samples[3].time"
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%v: %v", p.Path, p.Message)
+}
+
+// The top level fields checked by Validate
+type rawDocument struct {
+	Version                string             `json:"version"`
+	DynamicSamplesPresentB bool               `json:"dynamicSamplesPresentB"`
+	DynamicDataInfo        dynamicDataInfo    `json:"dynamicDataInfo"`
+	DataOutline            []outlineEntry     `json:"dataOutline"`
+	DataDynamicSamples     []rawDynamicSample `json:"dataDynamicSamples"`
+}
+
+// Accumulates problems while walking a document
+type validator struct {
+	problems   []Problem
+	timeFormat *regexp.Regexp
+	parseTime  func(string) (time.Time, error)
+	// Index of every sample set in dataDynamicSamples, and whether the outline uses it
+	sets       map[string]int
+	used       map[string]bool
+	matchNames map[string]string
+	samples    []rawDynamicSample
+}
+
+func (v *validator) add(path, format string, a ...interface{}) {
+	v.problems = append(v.problems, Problem{path, fmt.Sprintf(format, a...)})
+}
+
+// Returns whether a padded number has the sign and digits of a pattern
+// Digit counts come from the document, so they are compared without building a regular expression
+func matchesPattern(s string, p pattern) bool {
+	if p.IsSigned {
+		if s == "" || (s[0] != '+' && s[0] != '-') {
+			return false
+		}
+		s = s[1:]
+	}
+	integer, decimal := s, ""
+	if p.DigitsDecimal > 0 {
+		i := strings.IndexByte(s, '.')
+		if i < 0 {
+			return false
+		}
+		integer, decimal = s[:i], s[i+1:]
+	}
+	return len(integer) == p.DigitsInteger && len(decimal) == p.DigitsDecimal && onlyDigits(integer) && onlyDigits(decimal)
+}
+
+func onlyDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *validator) checkRange(path string, r mRange) {
+	for _, m := range []struct {
+		name string
+		minmax
+	}{{"occuring", r.Occuring}, {"legal", r.Legal}} {
+		if m.Min > m.Max {
+			v.add(path+"."+m.name, "min %v is greater than max %v", m.Min, m.Max)
+		}
+		if m.Min < -largestMgjsonNum || m.Max > largestMgjsonNum {
+			v.add(path+"."+m.name, "beyond the ±%v limit", largestMgjsonNum)
+		}
+	}
+}
+
+func (v *validator) checkNumber(path string, raw json.RawMessage, p pattern) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		v.add(path, "padded number is not a string")
+		return
+	}
+	if !matchesPattern(s, p) {
+		v.add(path, "%q does not match the pattern", s)
+		return
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < -largestMgjsonNum || n > largestMgjsonNum {
+		v.add(path, "%q is beyond the ±%v limit", s, largestMgjsonNum)
+	}
+}
+
+// Checks a sample or static value against its data type
+func (v *validator) checkValue(path string, raw json.RawMessage, dt dataType) {
+	switch dt.Type {
+	case "numberString":
+		v.checkNumber(path, raw, dt.NumberStringProperties.Pattern)
+	case "numberStringArray":
+		if dt.NumberArrayProperties == nil {
+			return
+		}
+		var xs []json.RawMessage
+		if err := json.Unmarshal(raw, &xs); err != nil {
+			v.add(path, "padded array is not an array")
+			return
+		}
+		if len(xs) != dt.NumberArrayProperties.ArraySize {
+			v.add(path, "%d dimensions, arraySize is %d", len(xs), dt.NumberArrayProperties.ArraySize)
+		}
+		for i, x := range xs {
+			v.checkNumber(fmt.Sprintf("%v[%d]", path, i), x, dt.NumberArrayProperties.Pattern)
+		}
+	case "paddedString":
+		var ps paddedStringValue
+		if err := json.Unmarshal(raw, &ps); err != nil {
+			v.add(path, "padded string is not an object with length and str")
+			return
+		}
+		properties := dt.PaddedStringProperties
+		if stringLength(ps.Str) != properties.MaxLen {
+			v.add(path+".str", "length is %d, maxLen is %d", stringLength(ps.Str), properties.MaxLen)
+		}
+		if len(ps.Length) != properties.MaxDigitsInStrLength {
+			v.add(path+".length", "%q does not have %d digits", ps.Length, properties.MaxDigitsInStrLength)
+		}
+		length, err := strconv.Atoi(ps.Length)
+		if _, ok := stringPrefix(ps.Str, length); err != nil || !ok {
+			v.add(path+".length", "%q is not a valid length for str", ps.Length)
+		}
+	}
+}
+
+// Checks a data type, returning false if its values can't be checked
+func (v *validator) checkDataType(path string, dt dataType) bool {
+	switch dt.Type {
+	case "numberString":
+		v.checkRange(path+".numberStringProperties.range", dt.NumberStringProperties.Range)
+	case "numberStringArray":
+		properties := dt.NumberArrayProperties
+		if properties == nil {
+			v.add(path, "missing numberArrayProperties")
+			return false
+		}
+		if len(properties.ArrayRanges.Ranges) != properties.ArraySize {
+			v.add(path+".numberArrayProperties.arrayRanges.ranges", "%d ranges, arraySize is %d", len(properties.ArrayRanges.Ranges), properties.ArraySize)
+		}
+		for i, r := range properties.ArrayRanges.Ranges {
+			v.checkRange(fmt.Sprintf("%v.numberArrayProperties.arrayRanges.ranges[%d]", path, i), r)
+		}
+	case "paddedString":
+		properties := dt.PaddedStringProperties
+		if len(strconv.Itoa(properties.MaxLen)) != properties.MaxDigitsInStrLength {
+			v.add(path+".paddedStringProperties.maxDigitsInStrLength", "%d does not fit maxLen %d", properties.MaxDigitsInStrLength, properties.MaxLen)
+		}
+	default:
+		v.add(path+".type", "unsupported data type %q", dt.Type)
+		return false
+	}
+	return true
+}
+
+func (v *validator) checkMatchName(path, matchName string) {
+	if matchName == "" {
+		v.add(path+".matchName", "missing matchName")
+		return
+	}
+	if previous, ok := v.matchNames[matchName]; ok {
+		v.add(path+".matchName", "%q is already used by %v", matchName, previous)
+		return
+	}
+	v.matchNames[matchName] = path
+}
+
+func (v *validator) checkDynamic(path string, entry outlineEntry) {
+	v.checkMatchName(path, entry.MatchName)
+
+	switch entry.Interpolation {
+	case InterpolationLinear:
+		if entry.DataType.Type == "paddedString" {
+			v.add(path+".interpolation", "strings can only use hold interpolation")
+		}
+	case InterpolationHold:
+	default:
+		v.add(path+".interpolation", "unknown interpolation %q", entry.Interpolation)
+	}
+
+	validType := v.checkDataType(path+".dataType", entry.DataType)
+
+	k, ok := v.sets[entry.SampleSetID]
+	if !ok {
+		v.add(path+".sampleSetID", "no samples found for %q", entry.SampleSetID)
+		return
+	}
+	if v.used[entry.SampleSetID] {
+		v.add(path+".sampleSetID", "%q is used by more than one stream", entry.SampleSetID)
+	}
+	v.used[entry.SampleSetID] = true
+
+	samples := v.samples[k].Samples
+	samplesPath := fmt.Sprintf("$.dataDynamicSamples[%d].samples", k)
+
+	if entry.SampleCount != len(samples) {
+		v.add(path+".sampleCount", "%d, but %d samples were found", entry.SampleCount, len(samples))
+	}
+
+	var previous time.Time
+	for i, s := range samples {
+		samplePath := fmt.Sprintf("%v[%d]", samplesPath, i)
+		if v.timeFormat != nil && !v.timeFormat.MatchString(s.Time) {
+			v.add(samplePath+".time", "%q does not match the time format", s.Time)
+		}
+		if v.parseTime != nil {
+			t, err := v.parseTime(s.Time)
+			if err != nil {
+				v.add(samplePath+".time", "%q is not a valid time", s.Time)
+			} else {
+				if i > 0 && !t.After(previous) {
+					v.add(samplePath+".time", "%q is not after the previous sample", s.Time)
+				}
+				previous = t
+			}
+		}
+		if validType {
+			v.checkValue(samplePath+".value", s.Value, entry.DataType)
+		}
+	}
+}
+
+func (v *validator) checkOutline(path string, entries []outlineEntry) {
+	for i, entry := range entries {
+		entryPath := fmt.Sprintf("%v[%d]", path, i)
+		switch entry.ObjectType {
+		case "dataDynamic":
+			v.checkDynamic(entryPath, entry)
+		case "dataStatic":
+			v.checkMatchName(entryPath, entry.MatchName)
+			if v.checkDataType(entryPath+".dataType", entry.DataType) {
+				v.checkValue(entryPath+".value", entry.Value, entry.DataType)
+			}
+		case "dataGroup":
+			v.checkOutline(entryPath+".children", entry.Children)
+		default:
+			v.add(entryPath+".objectType", "unknown object type %q", entry.ObjectType)
+		}
+	}
+}
+
+// Validate checks an mgJSON document against the rules followed by ToMgjson, and returns the problems found
+// Sample counts, padding of numbers and strings, time format and order, and the limits of numbers are checked
+// A valid document returns no problems
+func Validate(src []byte) []Problem {
+	v := validator{
+		sets:       map[string]int{},
+		used:       map[string]bool{},
+		matchNames: map[string]string{},
+	}
+
+	doc := rawDocument{}
+	err := json.Unmarshal(src, &doc)
+	if err != nil {
+		v.add("$", "%v", err)
+		return v.problems
+	}
+
+	if doc.Version == "" {
+		v.add("$.version", "missing version")
+	}
+
+	if doc.DynamicDataInfo.UseTimecodeB {
+		v.parseTime, err = timecodeParser(doc.DynamicDataInfo.TimecodeInfo)
+		if err != nil {
+			v.add("$.dynamicDataInfo.timecodeInfo", "%v", err)
+		}
+		v.timeFormat = timecodeFormat
+	} else {
+		precision := doc.DynamicDataInfo.UtcInfo.PrecisionLength
+		if precision < 1 || precision > 9 {
+			v.add("$.dynamicDataInfo.utcInfo.precisionLength", "%d is not between 1 and 9", precision)
+		} else {
+			// The precision is checked first, as larger repeat counts would not compile
+			v.timeFormat, err = regexp.Compile(fmt.Sprintf(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{%d}(Z|[+-]\d{2}:\d{2})$`, precision))
+			if err != nil {
+				v.add("$.dynamicDataInfo.utcInfo.precisionLength", "%v", err)
+			}
+		}
+		v.parseTime = parseDocumentTime
+	}
+
+	v.samples = doc.DataDynamicSamples
+	for k, set := range doc.DataDynamicSamples {
+		if _, ok := v.sets[set.SampleSetID]; ok {
+			v.add(fmt.Sprintf("$.dataDynamicSamples[%d].sampleSetID", k), "%q is repeated", set.SampleSetID)
+			continue
+		}
+		v.sets[set.SampleSetID] = k
+	}
+
+	v.checkOutline("$.dataOutline", doc.DataOutline)
+
+	for k, set := range doc.DataDynamicSamples {
+		if !v.used[set.SampleSetID] {
+			v.add(fmt.Sprintf("$.dataDynamicSamples[%d].sampleSetID", k), "%q is not in the outline", set.SampleSetID)
+		}
+	}
+
+	if doc.DynamicSamplesPresentB != (len(doc.DataDynamicSamples) > 0) {
+		v.add("$.dynamicSamplesPresentB", "%v, but %d sample sets were found", doc.DynamicSamplesPresentB, len(doc.DataDynamicSamples))
+	}
+
+	return v.problems
+}